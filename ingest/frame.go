@@ -0,0 +1,36 @@
+package ingest
+
+// FrameSplitter splits a byte stream into 0x7E delimited msg frames, bytes
+// outside of frames are dropped.
+type FrameSplitter struct {
+	buf     []byte
+	inFrame bool
+}
+
+// MaxFrameSize bounds the frames buffered, longer runs without delimiter are
+// dropped as garbage.
+var MaxFrameSize = 64 * 1024
+
+// Write feeds p into the splitter and calls emit with each completed frame,
+// including both delimiters. The frame is only valid during the call.
+func (fs *FrameSplitter) Write(p []byte, emit func(frame []byte)) {
+	for _, b := range p {
+		if b != 0x7E {
+			if fs.inFrame {
+				fs.buf = append(fs.buf, b)
+				if len(fs.buf) > MaxFrameSize {
+					fs.buf, fs.inFrame = fs.buf[:0], false
+				}
+			}
+			continue
+		}
+		if fs.inFrame && len(fs.buf) > 1 {
+			fs.buf = append(fs.buf, b)
+			emit(fs.buf)
+			fs.buf, fs.inFrame = fs.buf[:0], false
+			continue
+		}
+		// start of frame, consecutive delimiters restart it
+		fs.buf, fs.inFrame = append(fs.buf[:0], b), true
+	}
+}
@@ -0,0 +1,23 @@
+package ingest
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestFrameSplitter(t *testing.T) {
+	var frames []string
+	emit := func(frame []byte) {
+		frames = append(frames, hex.EncodeToString(frame))
+	}
+	fs := &FrameSplitter{}
+	// garbage, a frame split in two writes, back to back frames sharing no delimiter
+	fs.Write([]byte{0x01, 0x02, 0x7E, 0x00, 0x02}, emit)
+	fs.Write([]byte{0x00, 0x7E, 0x7E, 0x80, 0x01, 0x7E, 0x7E, 0x7E, 0x05, 0x7E, 0x03}, emit)
+
+	want := []string{"7e0002007e", "7e80017e", "7e057e"}
+	if !reflect.DeepEqual(frames, want) {
+		t.Fatalf("frames %v, want %v", frames, want)
+	}
+}
@@ -0,0 +1,126 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"loghub/msg"
+	"os"
+	"time"
+)
+
+// LogRecorder stores codec log lines as well as captured frames, it is
+// implemented by msg.MsgDB.
+type LogRecorder interface {
+	Recorder
+	StoreLog(line string, src *msg.LogSource) error
+}
+
+type ImportOptions struct {
+	DS  uint8
+	TTL time.Duration
+	// Format and Location apply to codec logs, see msg.LogSource.
+	Format   string
+	Location *time.Location
+	// ServerPort applies to captures, see StreamAssembler.
+	ServerPort int
+}
+
+type ImportStats struct {
+	Msgs   int
+	Errors int
+}
+
+// maxLogLineSize bounds the codec log lines read, a frame is at most a few
+// KB in hex.
+const maxLogLineSize = 1 << 20
+
+// ImportFile imports a codec log or a pcap/pcapng capture, either of which
+// may be gzip compressed. Lines or frames which fail to decode are logged and
+// counted in the returned stats.
+func ImportFile(path string, rec LogRecorder, opts *ImportOptions) (*ImportStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Import(f, path, rec, opts)
+}
+
+// Import is like ImportFile but reads r, name is recorded as the source file.
+func Import(r io.Reader, name string, rec LogRecorder, opts *ImportOptions) (*ImportStats, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(2); bytes.Equal(head, []byte{0x1F, 0x8B}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+	if head, _ := br.Peek(4); IsCapture(head) {
+		return importCapture(br, name, rec, opts)
+	}
+	return importLog(br, name, rec, opts)
+}
+
+func importLog(r io.Reader, name string, rec LogRecorder, opts *ImportOptions) (*ImportStats, error) {
+	src := &msg.LogSource{
+		DS:       opts.DS,
+		TTL:      opts.TTL,
+		Format:   opts.Format,
+		Location: opts.Location,
+		File:     name,
+	}
+	stats := &ImportStats{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := rec.StoreLog(line, src); err != nil {
+			stats.Errors++
+			log.Println(fmt.Errorf("import %s:%d: %w", name, lineNo, err))
+			continue
+		}
+		stats.Msgs++
+	}
+	return stats, scanner.Err()
+}
+
+func importCapture(r io.Reader, name string, rec LogRecorder, opts *ImportOptions) (*ImportStats, error) {
+	stats := &ImportStats{}
+	sa := &StreamAssembler{
+		ServerPort: opts.ServerPort,
+		Emit: func(ts time.Time, frame []byte, tx bool, peer, conn string) {
+			r := &msg.Record{
+				Raw:       append([]byte(nil), frame...),
+				TX:        tx,
+				Timestamp: ts,
+				DS:        opts.DS,
+				TTL:       opts.TTL,
+				Extra: map[string]string{
+					msg.ExtraPeer: peer,
+					msg.ExtraConn: conn,
+					msg.ExtraFile: name,
+				},
+			}
+			if err := rec.Store(r); err != nil {
+				stats.Errors++
+				log.Println(fmt.Errorf("import %s: %w: %X", name, err, frame))
+				return
+			}
+			stats.Msgs++
+		},
+	}
+	err := ReadCapture(r, func(p *Packet) error {
+		sa.Add(p)
+		return nil
+	})
+	return stats, err
+}
@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"loghub/msg"
+	"net"
+	"testing"
+	"time"
+)
+
+type fakeLogRecorder struct {
+	fakeRecorder
+	lines []string
+	srcs  []*msg.LogSource
+}
+
+func (fr *fakeLogRecorder) StoreLog(line string, src *msg.LogSource) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.lines = append(fr.lines, line)
+	fr.srcs = append(fr.srcs, src)
+	return nil
+}
+
+func TestImportGzipLog(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("20230425110139 Rx 7E000200000138001380000001A97E\n\n20230425110140 Tx 7E8001000501380013800000010001000200017E\n"))
+	zw.Close()
+
+	rec := &fakeLogRecorder{}
+	stats, err := Import(&buf, "codec.log.gz", rec, &ImportOptions{DS: 2, Format: "iso8601"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Msgs != 2 || stats.Errors != 0 || len(rec.lines) != 2 {
+		t.Fatalf("stats %+v, lines %q", stats, rec.lines)
+	}
+	if src := rec.srcs[0]; src.DS != 2 || src.Format != "iso8601" || src.File != "codec.log.gz" {
+		t.Errorf("log source %+v", src)
+	}
+}
+
+// pcapWriter writes Ethernet/IPv4/TCP packets to a pcap file.
+type pcapWriter struct {
+	buf bytes.Buffer
+	ts  time.Time
+}
+
+func newPcapWriter() *pcapWriter {
+	pw := &pcapWriter{ts: time.Date(2023, 4, 25, 3, 1, 39, 0, time.UTC)}
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr, pcapMagicMicro)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], 65535)
+	binary.LittleEndian.PutUint32(hdr[20:], LinkTypeEthernet)
+	pw.buf.Write(hdr)
+	return pw
+}
+
+func buildTCPPacket(src, dst *net.TCPAddr, seq uint32, flags byte, payload []byte) []byte {
+	pkt := make([]byte, 14+20+20, 14+20+20+len(payload))
+	binary.BigEndian.PutUint16(pkt[12:], 0x0800)
+	ip := pkt[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(40+len(payload)))
+	ip[8], ip[9] = 64, 6
+	copy(ip[12:], src.IP.To4())
+	copy(ip[16:], dst.IP.To4())
+	tcp := ip[20:]
+	binary.BigEndian.PutUint16(tcp, uint16(src.Port))
+	binary.BigEndian.PutUint16(tcp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12], tcp[13] = 5<<4, flags
+	return append(pkt, payload...)
+}
+
+func (pw *pcapWriter) write(src, dst *net.TCPAddr, seq uint32, flags byte, payload []byte) {
+	pkt := buildTCPPacket(src, dst, seq, flags, payload)
+	pw.ts = pw.ts.Add(time.Millisecond)
+	rec := make([]byte, 16)
+	binary.LittleEndian.PutUint32(rec, uint32(pw.ts.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(pw.ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(pkt)))
+	pw.buf.Write(rec)
+	pw.buf.Write(pkt)
+}
+
+func TestImportPcap(t *testing.T) {
+	heartbeat, _ := hex.DecodeString("7e000200000138001380000001a97e")
+	reply, _ := hex.DecodeString("7e8001000501380013800000010001000200017e")
+	terminal := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 52011}
+	platform := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 7611}
+
+	pw := newPcapWriter()
+	pw.write(terminal, platform, 999, tcpFlagSYN, nil)
+	pw.write(platform, terminal, 4999, tcpFlagSYN|tcpFlagACK, nil)
+	// heartbeat split in two segments, sent out of order and retransmitted
+	pw.write(terminal, platform, 1006, tcpFlagACK, heartbeat[6:])
+	pw.write(terminal, platform, 1000, tcpFlagACK, heartbeat[:6])
+	pw.write(terminal, platform, 1000, tcpFlagACK, heartbeat[:6])
+	pw.write(platform, terminal, 5000, tcpFlagACK, reply)
+	// heartbeat again after the reply
+	pw.write(terminal, platform, 1000+uint32(len(heartbeat)), tcpFlagACK, heartbeat)
+
+	rec := &fakeLogRecorder{}
+	stats, err := Import(&pw.buf, "capture.pcap", rec, &ImportOptions{DS: 1, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Msgs != 3 || stats.Errors != 0 || len(rec.records) != 3 {
+		t.Fatalf("stats %+v, records %d", stats, len(rec.records))
+	}
+	for i, want := range []struct {
+		raw []byte
+		tx  bool
+	}{{heartbeat, false}, {reply, true}, {heartbeat, false}} {
+		r := rec.records[i]
+		if !bytes.Equal(r.Raw, want.raw) || r.TX != want.tx || r.DS != 1 || r.TTL != time.Hour {
+			t.Errorf("record %d: %X tx %v ds %d ttl %v", i, r.Raw, r.TX, r.DS, r.TTL)
+		}
+		if r.Extra[msg.ExtraPeer] != terminal.String() || r.Extra[msg.ExtraConn] != "pcap-1" || r.Extra[msg.ExtraFile] != "capture.pcap" {
+			t.Errorf("record %d extra %v", i, r.Extra)
+		}
+	}
+	if ts := rec.records[0].Timestamp; !ts.Equal(time.Date(2023, 4, 25, 3, 1, 39, 4e6, time.UTC)) {
+		t.Errorf("record 0 timestamp %v", ts)
+	}
+}
+
+func TestReadPcapng(t *testing.T) {
+	block := func(blockType uint32, body []byte) []byte {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		b := make([]byte, 8, 12+len(body))
+		binary.LittleEndian.PutUint32(b, blockType)
+		binary.LittleEndian.PutUint32(b[4:], uint32(12+len(body)))
+		b = append(b, body...)
+		return binary.LittleEndian.AppendUint32(b, uint32(12+len(body)))
+	}
+	var buf bytes.Buffer
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb, pcapngByteOrder)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	buf.Write(block(pcapngBlockSHB, shb))
+	// raw IP interface with nanosecond timestamps
+	idb := []byte{LinkTypeRaw, 0, 0, 0, 0, 0, 0, 0, pcapngOptTsresol, 0, 1, 0, 9, 0, 0, 0, 0, 0, 0, 0}
+	buf.Write(block(pcapngBlockIDB, idb))
+	ts := time.Date(2023, 4, 25, 3, 1, 39, 123456789, time.UTC)
+	payload := buildTCPPacket(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 52011}, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 7611}, 1, tcpFlagACK, []byte{0x7E})[14:]
+	epb := make([]byte, 20, 20+len(payload))
+	binary.LittleEndian.PutUint32(epb[4:], uint32(uint64(ts.UnixNano())>>32))
+	binary.LittleEndian.PutUint32(epb[8:], uint32(ts.UnixNano()))
+	binary.LittleEndian.PutUint32(epb[12:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(epb[16:], uint32(len(payload)))
+	buf.Write(block(pcapngBlockEPB, append(epb, payload...)))
+
+	var packets []Packet
+	if err := ReadCapture(&buf, func(p *Packet) error {
+		packets = append(packets, Packet{p.Timestamp, p.LinkType, append([]byte(nil), p.Data...)})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 1 || !packets[0].Timestamp.Equal(ts) || packets[0].LinkType != LinkTypeRaw || !bytes.Equal(packets[0].Data, payload) {
+		t.Fatalf("packets %+v", packets)
+	}
+	seg, ok := decodeTCP(&packets[0])
+	if !ok || seg.src.Port != 52011 || seg.dst.Port != 7611 || !bytes.Equal(seg.payload, []byte{0x7E}) {
+		t.Errorf("segment %+v, ok %v", seg, ok)
+	}
+}
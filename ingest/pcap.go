@@ -0,0 +1,233 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Link types of captured packets, see https://www.tcpdump.org/linktypes.html.
+const (
+	LinkTypeNull     = 0
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLinuxSLL = 113
+	LinkTypeIPv4     = 228
+	LinkTypeIPv6     = 229
+	LinkTypeLoop     = 108
+	LinkTypeSLL2     = 276
+)
+
+var ErrBadCapture = errors.New("bad capture file")
+
+// Packet is a captured link layer frame.
+type Packet struct {
+	Timestamp time.Time
+	LinkType  uint32
+	Data      []byte
+}
+
+const (
+	pcapMagicMicro    = 0xA1B2C3D4
+	pcapMagicNano     = 0xA1B23C4D
+	pcapngBlockSHB    = 0x0A0D0D0A
+	pcapngBlockIDB    = 0x00000001
+	pcapngBlockSPB    = 0x00000003
+	pcapngBlockEPB    = 0x00000006
+	pcapngByteOrder   = 0x1A2B3C4D
+	pcapngOptTsresol  = 9
+	maxCaptureRecSize = 1 << 24
+)
+
+// IsCapture reports whether head starts like a pcap or pcapng file.
+func IsCapture(head []byte) bool {
+	if len(head) < 4 {
+		return false
+	}
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch bo.Uint32(head) {
+		case pcapMagicMicro, pcapMagicNano, pcapngBlockSHB:
+			return true
+		}
+	}
+	return false
+}
+
+// ReadCapture calls fn with each packet of a pcap or pcapng file, the packet
+// data is only valid during the call.
+func ReadCapture(r io.Reader, fn func(p *Packet) error) error {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(4)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadCapture, err)
+	}
+	if binary.LittleEndian.Uint32(head) == pcapngBlockSHB {
+		return readPcapng(br, fn)
+	}
+	return readPcap(br, fn)
+}
+
+func readPcap(r io.Reader, fn func(p *Packet) error) error {
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadCapture, err)
+	}
+	var bo binary.ByteOrder = binary.LittleEndian
+	magic := bo.Uint32(hdr)
+	if magic != pcapMagicMicro && magic != pcapMagicNano {
+		bo = binary.BigEndian
+		magic = bo.Uint32(hdr)
+	}
+	var unit time.Duration
+	switch magic {
+	case pcapMagicMicro:
+		unit = time.Microsecond
+	case pcapMagicNano:
+		unit = time.Nanosecond
+	default:
+		return fmt.Errorf("%w: magic %08X", ErrBadCapture, magic)
+	}
+	p := &Packet{LinkType: bo.Uint32(hdr[20:]) & 0x0FFFFFFF}
+	rec := make([]byte, 16)
+	var data []byte
+	for {
+		if _, err := io.ReadFull(r, rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w: %v", ErrBadCapture, err)
+		}
+		size := bo.Uint32(rec[8:])
+		if size > maxCaptureRecSize {
+			return fmt.Errorf("%w: record size %d", ErrBadCapture, size)
+		}
+		if cap(data) < int(size) {
+			data = make([]byte, size)
+		}
+		data = data[:size]
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("%w: %v", ErrBadCapture, err)
+		}
+		p.Timestamp = time.Unix(int64(bo.Uint32(rec)), int64(bo.Uint32(rec[4:]))*int64(unit))
+		p.Data = data
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+}
+
+type pcapngInterface struct {
+	linkType uint32
+	// tsUnit is the timestamp resolution in units per second
+	tsUnit uint64
+}
+
+func readPcapng(r io.Reader, fn func(p *Packet) error) error {
+	var bo binary.ByteOrder = binary.LittleEndian
+	var ifaces []pcapngInterface
+	hdr := make([]byte, 8)
+	var body []byte
+	for {
+		if _, err := io.ReadFull(r, hdr); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w: %v", ErrBadCapture, err)
+		}
+		blockType := bo.Uint32(hdr)
+		if blockType == pcapngBlockSHB {
+			// the byte order may change with each section
+			var order [4]byte
+			if _, err := io.ReadFull(r, order[:]); err != nil {
+				return fmt.Errorf("%w: %v", ErrBadCapture, err)
+			}
+			switch {
+			case binary.LittleEndian.Uint32(order[:]) == pcapngByteOrder:
+				bo = binary.LittleEndian
+			case binary.BigEndian.Uint32(order[:]) == pcapngByteOrder:
+				bo = binary.BigEndian
+			default:
+				return fmt.Errorf("%w: byte order magic %X", ErrBadCapture, order)
+			}
+			ifaces = ifaces[:0]
+		}
+		size := bo.Uint32(hdr[4:])
+		if size < 12 || size%4 != 0 || size > maxCaptureRecSize {
+			return fmt.Errorf("%w: block size %d", ErrBadCapture, size)
+		}
+		n := int(size) - 8
+		if blockType == pcapngBlockSHB {
+			n -= 4
+		}
+		if cap(body) < n {
+			body = make([]byte, n)
+		}
+		body = body[:n]
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("%w: %v", ErrBadCapture, err)
+		}
+		body = body[:n-4] // trailing block total length
+		switch blockType {
+		case pcapngBlockIDB:
+			if len(body) < 8 {
+				return fmt.Errorf("%w: short interface block", ErrBadCapture)
+			}
+			iface := pcapngInterface{linkType: uint32(bo.Uint16(body)), tsUnit: 1e6}
+			opts := body[8:]
+			for len(opts) >= 4 {
+				code, l := bo.Uint16(opts), int(bo.Uint16(opts[2:]))
+				if 4+l > len(opts) {
+					break
+				}
+				if code == pcapngOptTsresol && l >= 1 {
+					v := opts[4]
+					base := uint64(10)
+					if v&0x80 != 0 {
+						base = 2
+					}
+					iface.tsUnit = 1
+					for i := 0; i < int(v&0x7F); i++ {
+						iface.tsUnit *= base
+					}
+				}
+				opts = opts[4+(l+3)&^3:]
+			}
+			ifaces = append(ifaces, iface)
+		case pcapngBlockEPB:
+			if len(body) < 20 {
+				return fmt.Errorf("%w: short packet block", ErrBadCapture)
+			}
+			id := bo.Uint32(body)
+			if int(id) >= len(ifaces) {
+				return fmt.Errorf("%w: unknown interface %d", ErrBadCapture, id)
+			}
+			capLen := bo.Uint32(body[12:])
+			if int(capLen) > len(body)-20 {
+				return fmt.Errorf("%w: packet length %d", ErrBadCapture, capLen)
+			}
+			ts := uint64(bo.Uint32(body[4:]))<<32 | uint64(bo.Uint32(body[8:]))
+			unit := ifaces[id].tsUnit
+			p := &Packet{
+				Timestamp: time.Unix(int64(ts/unit), int64(ts%unit*1e9/unit)),
+				LinkType:  ifaces[id].linkType,
+				Data:      body[20 : 20+capLen],
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		case pcapngBlockSPB:
+			// simple packets carry no timestamp or captured length
+			if len(ifaces) == 0 || len(body) < 4 {
+				return fmt.Errorf("%w: bad simple packet block", ErrBadCapture)
+			}
+			p := &Packet{LinkType: ifaces[0].linkType, Data: body[4:]}
+			if l := bo.Uint32(body); int(l) < len(p.Data) {
+				p.Data = p.Data[:l]
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+	}
+}
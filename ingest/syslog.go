@@ -0,0 +1,287 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"loghub/msg"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// syslogMsg is the part of a syslog message used to store the codec log line
+// it carries.
+type syslogMsg struct {
+	Hostname string
+	AppName  string
+	Message  string
+}
+
+// parseSyslog parses a RFC 5424 or RFC 3164 message, nil values ("-") are
+// returned empty.
+func parseSyslog(data []byte) (*syslogMsg, bool) {
+	s := strings.TrimRight(string(data), "\x00\r\n")
+	if !strings.HasPrefix(s, "<") {
+		return nil, false
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return nil, false
+	}
+	if _, err := strconv.ParseUint(s[1:end], 10, 8); err != nil {
+		return nil, false
+	}
+	s = s[end+1:]
+	if strings.HasPrefix(s, "1 ") {
+		return parseSyslog5424(s[2:])
+	}
+	return parseSyslog3164(s), true
+}
+
+func parseSyslog5424(s string) (*syslogMsg, bool) {
+	// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+	fields := strings.SplitN(s, " ", 6)
+	if len(fields) < 6 {
+		return nil, false
+	}
+	nilValue := func(v string) string {
+		if v == "-" {
+			return ""
+		}
+		return v
+	}
+	sm := &syslogMsg{Hostname: nilValue(fields[1]), AppName: nilValue(fields[2])}
+	rest := fields[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		// skip the SD-ELEMENTs, "]" may be escaped within param values
+		for strings.HasPrefix(rest, "[") {
+			i, quoted := 1, false
+			for ; i < len(rest); i++ {
+				c := rest[i]
+				if c == '\\' && quoted {
+					i++
+				} else if c == '"' {
+					quoted = !quoted
+				} else if c == ']' && !quoted {
+					break
+				}
+			}
+			if i >= len(rest) {
+				return nil, false
+			}
+			rest = rest[i+1:]
+		}
+	}
+	rest = strings.TrimPrefix(rest, " ")
+	sm.Message = strings.TrimPrefix(rest, "\ufeff")
+	return sm, true
+}
+
+func parseSyslog3164(s string) *syslogMsg {
+	// Mmm dd hh:mm:ss HOSTNAME TAG: MSG, with the header being optional
+	if len(s) >= 16 && s[3] == ' ' && s[6] == ' ' && s[9] == ':' && s[12] == ':' && s[15] == ' ' {
+		s = s[16:]
+	} else {
+		return &syslogMsg{Message: s}
+	}
+	sm := &syslogMsg{}
+	sm.Hostname, s, _ = strings.Cut(s, " ")
+	if i := strings.IndexAny(s, "[: "); i > 0 {
+		sm.AppName = s[:i]
+		if s[i] == '[' {
+			if j := strings.IndexByte(s, ']'); j > i {
+				i = j + 1
+			}
+		}
+		s = strings.TrimPrefix(s[i:], ":")
+	}
+	sm.Message = strings.TrimPrefix(s, " ")
+	return sm
+}
+
+// maxSyslogMsgSize bounds the syslog messages received over TCP.
+const maxSyslogMsgSize = 64 * 1024
+
+// SyslogServer receives codec log lines forwarded over syslog on UDP and TCP,
+// with TCP messages framed by octet counting or newlines (RFC 6587).
+type SyslogServer struct {
+	Recorder LogRecorder
+	// Source is how the log lines are stored, its Host is the syslog hostname.
+	Source msg.LogSource
+	// Routes maps an app-name or hostname to the DS of its msgs, app-names
+	// are looked up first. Msgs of other senders go to Source.DS.
+	Routes map[string]uint8
+
+	udp net.PacketConn
+	tcp net.Listener
+
+	lock      sync.Mutex
+	conns     map[net.Conn]bool // nil once closed
+	closeWait sync.WaitGroup
+}
+
+// ListenSyslog listens on both UDP and TCP at bind.
+func ListenSyslog(bind string, rec LogRecorder, src *msg.LogSource, routes map[string]uint8) (*SyslogServer, error) {
+	udp, err := net.ListenPacket("udp", bind)
+	if err != nil {
+		return nil, err
+	}
+	tcp, err := net.Listen("tcp", bind)
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+	ss := &SyslogServer{Recorder: rec, Source: *src, Routes: routes, udp: udp, tcp: tcp, conns: make(map[net.Conn]bool)}
+	ss.closeWait.Add(2)
+	go ss.udpTask()
+	go ss.acceptTask()
+	return ss, nil
+}
+
+func (ss *SyslogServer) UDPAddr() net.Addr {
+	return ss.udp.LocalAddr()
+}
+
+func (ss *SyslogServer) TCPAddr() net.Addr {
+	return ss.tcp.Addr()
+}
+
+// Close stops receiving, closes the TCP connections and returns once the
+// messages being handled are stored.
+func (ss *SyslogServer) Close() error {
+	ss.tcp.Close()
+	err := ss.udp.Close()
+	ss.lock.Lock()
+	conns := ss.conns
+	ss.conns = nil
+	ss.lock.Unlock()
+	for conn := range conns {
+		conn.Close()
+	}
+	ss.closeWait.Wait()
+	return err
+}
+
+// track adds a connection to be closed by Close, which waits for its
+// handler. It returns false if the server is closed.
+func (ss *SyslogServer) track(conn net.Conn) bool {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	if ss.conns == nil {
+		return false
+	}
+	ss.conns[conn] = true
+	ss.closeWait.Add(1)
+	return true
+}
+
+func (ss *SyslogServer) untrack(conn net.Conn) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	delete(ss.conns, conn)
+}
+
+func (ss *SyslogServer) handle(data []byte) {
+	sm, ok := parseSyslog(data)
+	if !ok {
+		log.Println(fmt.Errorf("syslog: invalid message: %q", data))
+		return
+	}
+	line := strings.Trim(sm.Message, "\x00\r\n\t ")
+	if line == "" {
+		return
+	}
+	src := ss.Source
+	src.Host = sm.Hostname
+	if ds, ok := ss.Routes[sm.AppName]; ok && sm.AppName != "" {
+		src.DS = ds
+	} else if ds, ok := ss.Routes[sm.Hostname]; ok && sm.Hostname != "" {
+		src.DS = ds
+	}
+	if err := ss.Recorder.StoreLog(line, &src); err != nil {
+		log.Println(fmt.Errorf("syslog: %w: %q", err, line))
+	}
+}
+
+func (ss *SyslogServer) udpTask() {
+	defer ss.closeWait.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := ss.udp.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		ss.handle(buf[:n])
+	}
+}
+
+func (ss *SyslogServer) acceptTask() {
+	defer ss.closeWait.Done()
+	for {
+		conn, err := ss.tcp.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		if !ss.track(conn) {
+			conn.Close()
+			return
+		}
+		go ss.handleConn(conn)
+	}
+}
+
+func (ss *SyslogServer) handleConn(conn net.Conn) {
+	defer ss.closeWait.Done()
+	defer ss.untrack(conn)
+	defer conn.Close()
+	br := bufio.NewReaderSize(conn, maxSyslogMsgSize)
+	for {
+		head, err := br.Peek(1)
+		if err != nil {
+			return
+		}
+		var data []byte
+		if head[0] >= '1' && head[0] <= '9' {
+			// octet counting: MSG-LEN SP SYSLOG-MSG, the length being
+			// bounded by the buffer
+			l, err := br.ReadSlice(' ')
+			if err != nil && err != bufio.ErrBufferFull {
+				return
+			}
+			n, err := strconv.Atoi(string(bytes.TrimSuffix(l, []byte{' '})))
+			if err != nil || n > maxSyslogMsgSize {
+				if len(l) > 16 {
+					l = l[:16]
+				}
+				log.Println(fmt.Errorf("syslog %s: invalid frame length %q", conn.RemoteAddr(), l))
+				return
+			}
+			data = make([]byte, n)
+			if _, err := io.ReadFull(br, data); err != nil {
+				return
+			}
+		} else {
+			line, err := br.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				log.Println(fmt.Errorf("syslog %s: message too long", conn.RemoteAddr()))
+				return
+			} else if err != nil && len(bytes.TrimSpace(line)) == 0 {
+				return
+			}
+			data = line
+		}
+		ss.handle(data)
+	}
+}
@@ -0,0 +1,159 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"loghub/msg"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	tests := []struct {
+		data string
+		want *syslogMsg
+	}{
+		{
+			"<134>1 2023-04-25T11:01:39.250+08:00 gw1 codec 1234 - - 20230425110139 Rx 7e000200000138001380000001a97e\n",
+			&syslogMsg{"gw1", "codec", "20230425110139 Rx 7e000200000138001380000001a97e"},
+		},
+		{
+			`<134>1 2023-04-25T11:01:39Z - codec - - [meta a="x\]y"][b c="d"] ` + "\ufeffline",
+			&syslogMsg{"", "codec", "line"},
+		},
+		{
+			"<13>Apr 25 11:01:39 gw2 codec[77]: 20230425110139 Rx 7e",
+			&syslogMsg{"gw2", "codec", "20230425110139 Rx 7e"},
+		},
+		{
+			"<13>Apr  5 11:01:39 gw2 codec: line",
+			&syslogMsg{"gw2", "codec", "line"},
+		},
+		{
+			"<13>no header",
+			&syslogMsg{"", "", "no header"},
+		},
+	}
+	for _, tt := range tests {
+		sm, ok := parseSyslog([]byte(tt.data))
+		if !ok || !reflect.DeepEqual(sm, tt.want) {
+			t.Errorf("parseSyslog(%q) = %+v, %v, want %+v", tt.data, sm, ok, tt.want)
+		}
+	}
+	for _, data := range []string{"", "no pri", "<1234>x", "<134>1 2023-04-25T11:01:39Z gw1 codec - - [unterminated"} {
+		if sm, ok := parseSyslog([]byte(data)); ok {
+			t.Errorf("parseSyslog(%q) = %+v, want invalid", data, sm)
+		}
+	}
+}
+
+func TestSyslogServer(t *testing.T) {
+	rec := &fakeLogRecorder{}
+	ss, err := ListenSyslog("127.0.0.1:0", rec, &msg.LogSource{DS: 1, Format: "iso8601"}, map[string]uint8{"codec": 5, "gw2": 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	udp, err := net.Dial("udp", ss.UDPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	udp.Write([]byte("<134>1 2023-04-25T11:01:39Z gw1 codec - - - line 1"))
+
+	tcp, err := net.Dial("tcp", ss.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	framed := "<13>Apr 25 11:01:39 gw2 other: line 2"
+	fmt.Fprintf(tcp, "%d %s<13>Apr 25 11:01:39 gw3 other: line 3\n", len(framed), framed)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec.mu.Lock()
+		n := len(rec.lines)
+		rec.mu.Unlock()
+		if n >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout, got %d lines", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	got := make(map[string]msg.LogSource)
+	for i, line := range rec.lines {
+		got[line] = *rec.srcs[i]
+	}
+	want := map[string]msg.LogSource{
+		"line 1": {DS: 5, Format: "iso8601", Host: "gw1"},
+		"line 2": {DS: 6, Format: "iso8601", Host: "gw2"},
+		"line 3": {DS: 1, Format: "iso8601", Host: "gw3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %+v, want %+v", got, want)
+	}
+}
+
+// connClosed reports whether the server closed conn.
+func connClosed(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	ne, ok := err.(net.Error)
+	return err != nil && !(ok && ne.Timeout())
+}
+
+func TestSyslogFrameLength(t *testing.T) {
+	ss, err := ListenSyslog("127.0.0.1:0", &fakeLogRecorder{}, &msg.LogSource{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	tcp, err := net.Dial("tcp", ss.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	// the length never ends, it must not be buffered past maxSyslogMsgSize
+	go tcp.Write(append([]byte{'1'}, bytes.Repeat([]byte{'0'}, 2*maxSyslogMsgSize)...))
+	if !connClosed(tcp) {
+		t.Errorf("long frame length accepted")
+	}
+}
+
+func TestSyslogServerClose(t *testing.T) {
+	rec := &fakeLogRecorder{}
+	ss, err := ListenSyslog("127.0.0.1:0", rec, &msg.LogSource{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Dial("tcp", ss.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	fmt.Fprintf(tcp, "<13>Apr 25 11:01:39 gw1 codec: line 1\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec.mu.Lock()
+		n := len(rec.lines)
+		rec.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ss.Close()
+	if !connClosed(tcp) {
+		t.Errorf("connection left open")
+	}
+}
@@ -0,0 +1,230 @@
+package ingest
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"loghub/msg"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Recorder stores captured msg frames, it is implemented by msg.MsgDB.
+type Recorder interface {
+	Store(r *msg.Record) error
+}
+
+// TapQueueSize bounds the frames captured by a Tap but not yet stored, past
+// it frames are dropped rather than holding up the forwarding.
+var TapQueueSize = 4096
+
+// Tap is a transparent TCP proxy between terminals and a platform, which
+// forwards bytes unchanged and records the msg frames of both directions.
+// Frames from the terminal are recorded as Rx and frames from the platform
+// as Tx, along with the terminal address and a connection id.
+type Tap struct {
+	Upstream string
+	DS       uint8
+	TTL      time.Duration
+	Recorder Recorder
+
+	listener   net.Listener
+	connSeq    uint64
+	records    chan *msg.Record
+	dropped    uint64
+	recordDone chan struct{}
+
+	lock     sync.Mutex
+	conns    map[net.Conn]bool // nil once closed
+	connWait sync.WaitGroup
+}
+
+func ListenTap(bind, upstream string, rec Recorder, ds uint8, ttl time.Duration) (*Tap, error) {
+	l, err := net.Listen("tcp", bind)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tap{
+		Upstream:   upstream,
+		DS:         ds,
+		TTL:        ttl,
+		Recorder:   rec,
+		listener:   l,
+		records:    make(chan *msg.Record, TapQueueSize),
+		recordDone: make(chan struct{}),
+		conns:      make(map[net.Conn]bool),
+	}
+	go t.acceptTask()
+	go t.recordTask()
+	return t, nil
+}
+
+func (t *Tap) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// Dropped is the number of frames not recorded as the queue was full.
+func (t *Tap) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Close stops accepting connections, closes the established ones and returns
+// once their queued frames are stored.
+func (t *Tap) Close() error {
+	err := t.listener.Close()
+	t.lock.Lock()
+	conns := t.conns
+	t.conns = nil
+	t.lock.Unlock()
+	for conn := range conns {
+		conn.Close()
+	}
+	t.connWait.Wait()
+	close(t.records)
+	<-t.recordDone
+	return err
+}
+
+// track adds a connection to be closed by Close, along with its handler to
+// be waited for if handler. It returns false if the Tap is closed.
+func (t *Tap) track(conn net.Conn, handler bool) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.conns == nil {
+		return false
+	}
+	t.conns[conn] = true
+	if handler {
+		t.connWait.Add(1)
+	}
+	return true
+}
+
+func (t *Tap) untrack(conn net.Conn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.conns, conn)
+}
+
+// recordTask stores the queued frames, apart from the forwarding so that a
+// slow Recorder never holds it up, until the queue is closed.
+func (t *Tap) recordTask() {
+	defer close(t.recordDone)
+	tk := time.NewTicker(time.Minute)
+	defer tk.Stop()
+	var reported uint64
+	store := func(r *msg.Record) {
+		if err := t.Recorder.Store(r); err != nil {
+			log.Println(fmt.Errorf("tap %s store: %w: %X", r.Extra[msg.ExtraConn], err, r.Raw))
+		}
+	}
+	for {
+		select {
+		case r, ok := <-t.records:
+			if !ok {
+				return
+			}
+			store(r)
+		case <-tk.C:
+			if dropped := t.Dropped(); dropped != reported {
+				log.Printf("tap dropped %d frames, the recorder is behind", dropped-reported)
+				reported = dropped
+			}
+		}
+	}
+}
+
+func (t *Tap) acceptTask() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		if !t.track(conn, true) {
+			conn.Close()
+			return
+		}
+		go t.handleConn(conn)
+	}
+}
+
+func (t *Tap) handleConn(conn net.Conn) {
+	defer t.connWait.Done()
+	defer t.untrack(conn)
+	defer conn.Close()
+	connID := "tap-" + strconv.FormatUint(atomic.AddUint64(&t.connSeq, 1), 10)
+	upstream, err := net.DialTimeout("tcp", t.Upstream, 10*time.Second)
+	if err != nil {
+		log.Println(fmt.Errorf("tap %s dial upstream: %w", connID, err))
+		return
+	}
+	defer upstream.Close()
+	if !t.track(upstream, false) {
+		return
+	}
+	defer t.untrack(upstream)
+	extra := map[string]string{
+		msg.ExtraPeer: conn.RemoteAddr().String(),
+		msg.ExtraConn: connID,
+	}
+	done := make(chan struct{}, 2)
+	go t.pipe(upstream, conn, false, extra, done)
+	go t.pipe(conn, upstream, true, extra, done)
+	// each side may close its half while the other keeps sending
+	<-done
+	<-done
+}
+
+// pipe forwards src to dst until src is closed, which is passed on by
+// closing the write half of dst. Both are closed on errors.
+func (t *Tap) pipe(dst, src net.Conn, tx bool, extra map[string]string, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+	fs := &FrameSplitter{}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				src.Close()
+				dst.Close()
+				return
+			}
+			fs.Write(buf[:n], func(frame []byte) {
+				r := &msg.Record{
+					Raw:       append([]byte(nil), frame...),
+					TX:        tx,
+					Timestamp: time.Now(),
+					DS:        t.DS,
+					TTL:       t.TTL,
+					Extra:     make(map[string]string, len(extra)),
+				}
+				for k, v := range extra {
+					r.Extra[k] = v
+				}
+				select {
+				case t.records <- r:
+				default:
+					atomic.AddUint64(&t.dropped, 1)
+				}
+			})
+		}
+		if err == io.EOF {
+			if tc, ok := dst.(*net.TCPConn); ok {
+				tc.CloseWrite()
+			} else {
+				dst.Close()
+			}
+			return
+		} else if err != nil {
+			src.Close()
+			dst.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"loghub/msg"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeRecorder struct {
+	mu      sync.Mutex
+	records []*msg.Record
+}
+
+func (fr *fakeRecorder) Store(r *msg.Record) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.records = append(fr.records, r)
+	return nil
+}
+
+func (fr *fakeRecorder) wait(t *testing.T, n int) []*msg.Record {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		fr.mu.Lock()
+		if len(fr.records) >= n {
+			records := append([]*msg.Record(nil), fr.records...)
+			fr.mu.Unlock()
+			return records
+		}
+		fr.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d records", n)
+	return nil
+}
+
+func TestTap(t *testing.T) {
+	heartbeat, _ := hex.DecodeString("7e000200000138001380000001a97e")
+	reply, _ := hex.DecodeString("7e8001000501380013800000010001000200017e")
+
+	// fake platform answers each heartbeat with a reply
+	platform, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer platform.Close()
+	go func() {
+		conn, err := platform.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, len(heartbeat))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		conn.Write(reply)
+	}()
+
+	rec := &fakeRecorder{}
+	tap, err := ListenTap("127.0.0.1:0", platform.Addr().String(), rec, 3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tap.Close()
+
+	// fake terminal writes the heartbeat in two pieces
+	conn, err := net.Dial("tcp", tap.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(heartbeat[:5])
+	time.Sleep(10 * time.Millisecond)
+	conn.Write(heartbeat[5:])
+
+	buf := make([]byte, len(reply))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, reply) {
+		t.Fatalf("forwarded %X, want %X", buf, reply)
+	}
+
+	records := rec.wait(t, 2)
+	if !bytes.Equal(records[0].Raw, heartbeat) || records[0].TX {
+		t.Errorf("record 0 %X tx %v", records[0].Raw, records[0].TX)
+	}
+	if !bytes.Equal(records[1].Raw, reply) || !records[1].TX {
+		t.Errorf("record 1 %X tx %v", records[1].Raw, records[1].TX)
+	}
+	for _, r := range records {
+		if r.DS != 3 || r.TTL != time.Hour {
+			t.Errorf("record ds %d ttl %v", r.DS, r.TTL)
+		}
+		if r.Extra[msg.ExtraPeer] != conn.LocalAddr().String() || r.Extra[msg.ExtraConn] != "tap-1" {
+			t.Errorf("record extra %v", r.Extra)
+		}
+	}
+}
+
+// blockingRecorder holds up every Store until released.
+type blockingRecorder struct {
+	release chan struct{}
+}
+
+func (br *blockingRecorder) Store(r *msg.Record) error {
+	<-br.release
+	return nil
+}
+
+func TestTapSlowRecorder(t *testing.T) {
+	queueSize := TapQueueSize
+	TapQueueSize = 1
+	defer func() { TapQueueSize = queueSize }()
+	heartbeat, _ := hex.DecodeString("7e000200000138001380000001a97e")
+	const count = 5
+
+	// fake platform echoes the heartbeats once it got them all
+	platform, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer platform.Close()
+	go func() {
+		conn, err := platform.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, count*len(heartbeat))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		conn.Write(buf)
+	}()
+
+	rec := &blockingRecorder{release: make(chan struct{})}
+	tap, err := ListenTap("127.0.0.1:0", platform.Addr().String(), rec, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tap.Close()
+	defer close(rec.release) // Close waits for the queued frames
+
+	conn, err := net.Dial("tcp", tap.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < count; i++ {
+		conn.Write(heartbeat)
+		time.Sleep(10 * time.Millisecond)
+	}
+	buf := make([]byte, count*len(heartbeat))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("forwarding held up by the recorder: %v", err)
+	}
+	if !bytes.Equal(buf, bytes.Repeat(heartbeat, count)) {
+		t.Errorf("forwarded %X", buf)
+	}
+	if dropped := tap.Dropped(); dropped == 0 {
+		t.Errorf("no frames dropped")
+	}
+}
+
+func TestTapHalfClose(t *testing.T) {
+	heartbeat, _ := hex.DecodeString("7e000200000138001380000001a97e")
+	reply, _ := hex.DecodeString("7e8001000501380013800000010001000200017e")
+
+	// fake platform replies once the terminal is done sending
+	platform, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer platform.Close()
+	go func() {
+		conn, err := platform.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := io.ReadAll(conn); err != nil {
+			return
+		}
+		conn.Write(reply)
+	}()
+
+	rec := &fakeRecorder{}
+	tap, err := ListenTap("127.0.0.1:0", platform.Addr().String(), rec, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tap.Close()
+
+	conn, err := net.Dial("tcp", tap.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(heartbeat)
+	conn.(*net.TCPConn).CloseWrite()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, reply) {
+		t.Fatalf("forwarded %X after half close, want %X", buf, reply)
+	}
+	if records := rec.wait(t, 2); !records[1].TX {
+		t.Errorf("reply not recorded")
+	}
+}
+
+func TestTapClose(t *testing.T) {
+	heartbeat, _ := hex.DecodeString("7e000200000138001380000001a97e")
+
+	// fake platform echoes and keeps the connection open
+	platform, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer platform.Close()
+	go func() {
+		conn, err := platform.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	rec := &fakeRecorder{}
+	tap, err := ListenTap("127.0.0.1:0", platform.Addr().String(), rec, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", tap.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(heartbeat)
+	buf := make([]byte, len(heartbeat))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	tap.Close()
+	rec.mu.Lock()
+	n := len(rec.records)
+	rec.mu.Unlock()
+	if n != 2 {
+		t.Errorf("%d frames stored on close, want 2", n)
+	}
+	if _, err := conn.Read(buf); err == nil {
+		t.Errorf("connection left open")
+	}
+}
@@ -0,0 +1,279 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// tcpSegment is the TCP part of a captured packet.
+type tcpSegment struct {
+	src, dst net.TCPAddr
+	seq      uint32
+	syn, ack bool
+	rst      bool
+	payload  []byte
+}
+
+const (
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+	tcpFlagACK = 0x10
+)
+
+// decodeTCP extracts the TCP segment of a packet, ok is false for other
+// protocols and IP fragments.
+func decodeTCP(p *Packet) (seg tcpSegment, ok bool) {
+	data := p.Data
+	var ethType uint16
+	switch p.LinkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return seg, false
+		}
+		ethType, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		for (ethType == 0x8100 || ethType == 0x88A8) && len(data) >= 4 {
+			ethType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return seg, false
+		}
+		ethType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case LinkTypeSLL2:
+		if len(data) < 20 {
+			return seg, false
+		}
+		ethType, data = binary.BigEndian.Uint16(data), data[20:]
+	case LinkTypeNull, LinkTypeLoop:
+		if len(data) < 4 {
+			return seg, false
+		}
+		data = data[4:]
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+	default:
+		return seg, false
+	}
+	if ethType != 0 && ethType != 0x0800 && ethType != 0x86DD {
+		return seg, false
+	}
+	if len(data) < 1 {
+		return seg, false
+	}
+
+	var srcIP, dstIP net.IP
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return seg, false
+		}
+		ihl := int(data[0]&0x0F) * 4
+		total := int(binary.BigEndian.Uint16(data[2:]))
+		if data[9] != 6 || ihl < 20 || total < ihl || total > len(data) {
+			return seg, false
+		}
+		if binary.BigEndian.Uint16(data[6:])&0x3FFF != 0 {
+			return seg, false // fragmented
+		}
+		srcIP, dstIP = net.IP(data[12:16]), net.IP(data[16:20])
+		data = data[ihl:total]
+	case 6:
+		if len(data) < 40 {
+			return seg, false
+		}
+		total := 40 + int(binary.BigEndian.Uint16(data[4:]))
+		if data[6] != 6 || total > len(data) {
+			return seg, false // extension headers are not followed
+		}
+		srcIP, dstIP = net.IP(data[8:24]), net.IP(data[24:40])
+		data = data[40:total]
+	default:
+		return seg, false
+	}
+
+	if len(data) < 20 {
+		return seg, false
+	}
+	off := int(data[12]>>4) * 4
+	if off < 20 || off > len(data) {
+		return seg, false
+	}
+	flags := data[13]
+	seg = tcpSegment{
+		src:     net.TCPAddr{IP: append(net.IP(nil), srcIP...), Port: int(binary.BigEndian.Uint16(data))},
+		dst:     net.TCPAddr{IP: append(net.IP(nil), dstIP...), Port: int(binary.BigEndian.Uint16(data[2:]))},
+		seq:     binary.BigEndian.Uint32(data[4:]),
+		syn:     flags&tcpFlagSYN != 0,
+		ack:     flags&tcpFlagACK != 0,
+		rst:     flags&tcpFlagRST != 0,
+		payload: data[off:],
+	}
+	return seg, true
+}
+
+// maxPendingSegments bounds the out of order segments held per direction,
+// past it the missing data is assumed lost from the capture and skipped.
+const maxPendingSegments = 64
+
+// halfStream reassembles one direction of a TCP connection.
+type halfStream struct {
+	started bool
+	nextSeq uint32
+	pending map[uint32][]byte
+	fs      FrameSplitter
+}
+
+// add feeds a segment and calls emit with the frames completed by it.
+func (hs *halfStream) add(seq uint32, syn bool, payload []byte, emit func(frame []byte)) {
+	if syn {
+		*hs = halfStream{started: true, nextSeq: seq + 1}
+		return
+	}
+	if len(payload) == 0 {
+		return
+	}
+	if !hs.started {
+		hs.started, hs.nextSeq = true, seq
+	}
+	diff := int32(seq - hs.nextSeq)
+	if diff > 0 {
+		if hs.pending == nil {
+			hs.pending = make(map[uint32][]byte)
+		}
+		hs.pending[seq] = append([]byte(nil), payload...)
+		if len(hs.pending) > maxPendingSegments {
+			hs.skipGap()
+			hs.drain(emit)
+		}
+		return
+	}
+	if -diff >= int32(len(payload)) {
+		return // retransmission
+	}
+	payload = payload[-diff:]
+	hs.fs.Write(payload, emit)
+	hs.nextSeq += uint32(len(payload))
+	hs.drain(emit)
+}
+
+// drain feeds the pending segments which became in order.
+func (hs *halfStream) drain(emit func(frame []byte)) {
+	for len(hs.pending) > 0 {
+		progress := false
+		for seq, payload := range hs.pending {
+			diff := int32(seq - hs.nextSeq)
+			if diff > 0 {
+				continue
+			}
+			delete(hs.pending, seq)
+			progress = true
+			if -diff < int32(len(payload)) {
+				payload = payload[-diff:]
+				hs.fs.Write(payload, emit)
+				hs.nextSeq += uint32(len(payload))
+			}
+		}
+		if !progress {
+			return
+		}
+	}
+}
+
+// skipGap moves past missing data to the earliest pending segment, the frame
+// in progress is dropped.
+func (hs *halfStream) skipGap() {
+	seqs := make([]uint32, 0, len(hs.pending))
+	for seq := range hs.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return int32(seqs[i]-hs.nextSeq) < int32(seqs[j]-hs.nextSeq) })
+	hs.nextSeq = seqs[0]
+	hs.fs = FrameSplitter{}
+}
+
+type flowKey struct {
+	a, b string
+}
+
+// tcpFlow is a TCP connection seen in a capture, the client is taken to be
+// the terminal.
+type tcpFlow struct {
+	id       string
+	client   string
+	isn      uint32
+	synSeen  bool
+	toServer halfStream
+	toClient halfStream
+}
+
+// StreamAssembler reassembles the TCP connections of captured packets and
+// splits them into msg frames.
+type StreamAssembler struct {
+	// ServerPort is the platform port, if zero the side sending the first
+	// SYN is taken as the terminal, or else the side with the higher port.
+	ServerPort int
+	// Emit is called with each frame, tx is true for frames sent to the
+	// terminal. The frame is only valid during the call.
+	Emit func(ts time.Time, frame []byte, tx bool, peer, conn string)
+
+	flows  map[flowKey]*tcpFlow
+	connID uint64
+}
+
+// Add feeds a captured packet, packets other than TCP are ignored.
+func (sa *StreamAssembler) Add(p *Packet) {
+	seg, ok := decodeTCP(p)
+	if !ok {
+		return
+	}
+	src, dst := seg.src.String(), seg.dst.String()
+	key := flowKey{src, dst}
+	if src > dst {
+		key = flowKey{dst, src}
+	}
+	if sa.flows == nil {
+		sa.flows = make(map[flowKey]*tcpFlow)
+	}
+	flow := sa.flows[key]
+	opening := seg.syn && !seg.ack
+	if flow == nil || (opening && flow.synSeen && flow.isn != seg.seq) {
+		// a new connection, or the reuse of the addresses of a closed one
+		sa.connID++
+		flow = &tcpFlow{id: "pcap-" + strconv.FormatUint(sa.connID, 10), client: sa.guessClient(&seg)}
+		sa.flows[key] = flow
+	}
+	if opening {
+		flow.isn, flow.synSeen = seg.seq, true
+	}
+	tx := src != flow.client
+	hs := &flow.toServer
+	if tx {
+		hs = &flow.toClient
+	}
+	hs.add(seg.seq, seg.syn, seg.payload, func(frame []byte) {
+		sa.Emit(p.Timestamp, frame, tx, flow.client, flow.id)
+	})
+	if seg.rst {
+		delete(sa.flows, key)
+	}
+}
+
+func (sa *StreamAssembler) guessClient(seg *tcpSegment) string {
+	switch {
+	case sa.ServerPort != 0 && seg.dst.Port == sa.ServerPort:
+		return seg.src.String()
+	case sa.ServerPort != 0 && seg.src.Port == sa.ServerPort:
+		return seg.dst.String()
+	case seg.syn:
+		if seg.ack {
+			return seg.dst.String()
+		}
+		return seg.src.String()
+	case seg.src.Port > seg.dst.Port:
+		return seg.src.String()
+	default:
+		return seg.dst.String()
+	}
+}
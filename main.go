@@ -2,11 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"log"
+	"loghub/ingest"
 	"loghub/msg"
 	"loghub/web"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "net/http/pprof"
 
@@ -15,29 +23,220 @@ import (
 
 func main() {
 	var opts struct {
-		DataDir      string `short:"d" long:"data-dir" default:"data" description:"Data file directory"`
-		BulkSize     uint   `short:"b" long:"bulk-size" default:"2000" description:"DB bulk set size"`
-		BindLogstash string `short:"l" long:"bind-logstash" default:":5044" description:"[host]:port Logstash bind address"`
-		BindWeb      string `short:"w" long:"bind-web" default:":6060" description:"[host]:port Web bind address"`
+		DataDir      string            `short:"d" long:"data-dir" default:"data" description:"Data file directory"`
+		BulkSize     uint              `short:"b" long:"bulk-size" default:"2000" description:"DB bulk set size"`
+		WriteLatency time.Duration     `long:"write-latency" default:"50ms" description:"Max time msgs wait to be committed along with others"`
+		WriteWorkers int               `long:"write-workers" default:"2" description:"Number of parallel DB writers"`
+		WriteQueue   int               `long:"write-queue" default:"256" description:"Number of batches queued for the writers before ingest blocks"`
+		BindLogstash string            `short:"l" long:"bind-logstash" default:":5044" description:"[host]:port Logstash bind address"`
+		BindWeb      string            `short:"w" long:"bind-web" default:":6060" description:"[host]:port Web bind address"`
+		TLSCert      string            `long:"tls-cert" description:"Certificate file enabling TLS on the Logstash and web listeners"`
+		TLSKey       string            `long:"tls-key" description:"Private key file of the TLS certificate"`
+		TLSClientCA  string            `long:"tls-client-ca" description:"CA file verifying client certificates, which are then required by Logstash and /api/ingest"`
+		TLSClientDS  map[string]string `long:"tls-client-ds" description:"subject:ds[,ds...] DS values a client certificate subject (common name or full subject) may write, may be repeated"`
+		LogFormats   map[string]string `short:"f" long:"log-format" description:"name:regexp Custom log line format selected by the fmt tag, may be repeated"`
+		Retentions   map[string]string `short:"r" long:"retention" description:"name:duration Retention class selected by the retention tag, may be repeated"`
+		Timezone     string            `short:"z" long:"timezone" description:"Zone of timestamps without offset and of msg body times unless a tz tag is given, defaults to the system zone and GMT+8 for bodies"`
+		DedupWindow  time.Duration     `long:"dedup-window" default:"24h" description:"How long stored msgs are remembered to drop re-shipped duplicates, 0 disables"`
+		RejectTTL    time.Duration     `long:"reject-ttl" description:"How long lines which fail to parse are kept, defaults to the max TTL"`
+		TapListen    string            `long:"tap-listen" description:"[host]:port Raw JT/T 808 TCP tap bind address, disabled if empty"`
+		TapUpstream  string            `long:"tap-upstream" description:"host:port Platform address the tap forwards connections to"`
+		TapDS        uint8             `long:"tap-ds" default:"0" description:"Data source of msgs captured by the tap"`
+		TapTTL       time.Duration     `long:"tap-ttl" default:"0" description:"TTL of msgs captured by the tap, defaults to the max TTL"`
+		SyslogListen string            `long:"syslog-listen" description:"[host]:port Syslog UDP and TCP bind address, disabled if empty"`
+		SyslogDS     map[string]uint8  `long:"syslog-ds" description:"name:ds Data source of syslog msgs by app-name or hostname, may be repeated"`
+		SyslogFormat string            `long:"syslog-fmt" description:"Log line format of syslog msgs, defaults to the default format"`
+		SyslogTTL    time.Duration     `long:"syslog-ttl" default:"0" description:"TTL of syslog msgs, defaults to the max TTL"`
+
+		Import importCommand `command:"import" description:"Import codec log files and pcap/pcapng captures into the data directory and exit"`
+		Dedupe dedupeCommand `command:"dedupe" description:"Remove the msgs stored more than once from the data directory and exit"`
 	}
 
-	_, err := flags.ParseArgs(&opts, os.Args)
-	if err != nil {
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.SubcommandsOptional = true
+	if _, err := parser.ParseArgs(os.Args[1:]); err != nil {
 		log.Fatalln(err)
 	}
 
+	if opts.Timezone != "" {
+		loc, err := time.LoadLocation(opts.Timezone)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		msg.DefaultLocation = loc
+	}
+
+	for name, pattern := range opts.LogFormats {
+		if err := msg.RegisterLogFormat(name, pattern); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	for name, val := range opts.Retentions {
+		ttl, err := time.ParseDuration(val)
+		if err != nil {
+			log.Fatalln(fmt.Errorf("retention %s: %w", name, err))
+		}
+		if ttl <= 0 || ttl > msg.MaxMsgTTL {
+			log.Fatalln(fmt.Errorf("retention %s: %v is not within (0, %v]", name, ttl, msg.MaxMsgTTL))
+		}
+		msg.RetentionClasses[name] = ttl
+	}
+
+	msg.WriteLatency, msg.WriteWorkers, msg.WriteQueueSize = opts.WriteLatency, opts.WriteWorkers, opts.WriteQueue
+	msg.DedupWindow = opts.DedupWindow
+
+	if opts.RejectTTL > 0 {
+		msg.RejectTTL = opts.RejectTTL
+	}
+
 	db, err := msg.OpenDB(opts.DataDir, opts.BulkSize)
 	if err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
 
-	if err := db.Listen(opts.BindLogstash); err != nil {
+	if parser.Active != nil {
+		var err error
+		switch parser.Active.Name {
+		case "import":
+			err = opts.Import.run(db)
+		case "dedupe":
+			err = opts.Dedupe.run(db)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	var lo *msg.ListenOptions
+	if opts.TLSCert != "" {
+		if lo, err = listenOptions(opts.TLSCert, opts.TLSKey, opts.TLSClientCA, opts.TLSClientDS); err != nil {
+			log.Fatalln(err)
+		}
+		if err := db.ListenTLS(opts.BindLogstash, lo); err != nil {
+			log.Fatalln(err)
+		}
+	} else if err := db.Listen(opts.BindLogstash); err != nil {
 		log.Fatalln(err)
 	}
 
-	web.Serve(opts.BindWeb, db)
+	if opts.TapListen != "" {
+		if opts.TapUpstream == "" {
+			log.Fatalln("tap-upstream is required by tap-listen")
+		}
+		tap, err := ingest.ListenTap(opts.TapListen, opts.TapUpstream, db, opts.TapDS, opts.TapTTL)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer tap.Close()
+	}
+
+	if opts.SyslogListen != "" {
+		if opts.SyslogFormat != "" {
+			if _, err := msg.LookupLogFormat(opts.SyslogFormat); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		src := &msg.LogSource{Format: opts.SyslogFormat, TTL: opts.SyslogTTL}
+		ss, err := ingest.ListenSyslog(opts.SyslogListen, db, src, opts.SyslogDS)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer ss.Close()
+	}
+
+	web.Serve(opts.BindWeb, db, lo)
 
 	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt)
 	<-ctx.Done()
 }
+
+func listenOptions(certFile, keyFile, clientCAFile string, clientDS map[string]string) (*msg.ListenOptions, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	lo := &msg.ListenOptions{TLS: &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", clientCAFile)
+		}
+		lo.TLS.ClientCAs = pool
+		lo.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if len(clientDS) > 0 {
+		if clientCAFile == "" {
+			return nil, errors.New("tls-client-ds requires tls-client-ca")
+		}
+		lo.AllowedDS = make(map[string][]uint8)
+		for subject, list := range clientDS {
+			for _, v := range strings.Split(list, ",") {
+				ds, err := strconv.ParseUint(strings.TrimSpace(v), 10, 8)
+				if err != nil {
+					return nil, fmt.Errorf("tls-client-ds %s: %w", subject, err)
+				}
+				lo.AllowedDS[subject] = append(lo.AllowedDS[subject], uint8(ds))
+			}
+		}
+	}
+	return lo, nil
+}
+
+type importCommand struct {
+	DS         uint8         `long:"ds" default:"0" description:"Data source of the imported msgs"`
+	TTL        time.Duration `long:"ttl" default:"0" description:"TTL of the imported msgs, defaults to the max TTL"`
+	Format     string        `long:"fmt" description:"Log line format of codec logs, defaults to the default format"`
+	Timezone   string        `long:"tz" description:"Zone of codec log timestamps without offset, defaults to the timezone option"`
+	ServerPort int           `long:"server-port" description:"Platform TCP port in captures, by default the side opening the connection is the terminal"`
+	Args       struct {
+		Files []string `positional-arg-name:"file" required:"1" description:"Codec log or pcap/pcapng file, may be gzip compressed"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (cmd *importCommand) run(db *msg.MsgDB) error {
+	opts := &ingest.ImportOptions{DS: cmd.DS, TTL: cmd.TTL, Format: cmd.Format, ServerPort: cmd.ServerPort}
+	if cmd.Format != "" {
+		if _, err := msg.LookupLogFormat(cmd.Format); err != nil {
+			return err
+		}
+	}
+	if cmd.Timezone != "" {
+		loc, err := time.LoadLocation(cmd.Timezone)
+		if err != nil {
+			return err
+		}
+		opts.Location = loc
+	}
+	for _, file := range cmd.Args.Files {
+		stats, err := ingest.ImportFile(file, db, opts)
+		if err != nil {
+			return fmt.Errorf("import %s: %w", file, err)
+		}
+		log.Printf("imported %s: %d msgs, %d errors", file, stats.Msgs, stats.Errors)
+	}
+	return nil
+}
+
+type dedupeCommand struct {
+	DryRun bool `long:"dry-run" description:"Only count the duplicates"`
+}
+
+func (cmd *dedupeCommand) run(db *msg.MsgDB) error {
+	stats, err := db.Dedupe(cmd.DryRun)
+	if err != nil {
+		return err
+	}
+	verb := "removed"
+	if cmd.DryRun {
+		verb = "found"
+	}
+	log.Printf("scanned %d msgs, %s %d duplicates", stats.Scanned, verb, stats.Removed)
+	return nil
+}
@@ -0,0 +1,161 @@
+package msg
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// replyTargets maps the response msg ids which carry the request serial
+// number as the leading WORD of their body to the msg id they answer.
+var replyTargets = map[uint16]uint16{
+	0x8100: 0x0100,
+	0x0104: 0x8104,
+	0x0201: 0x8201,
+	0x0302: 0x8302,
+	0x0500: 0x8500,
+	0x0700: 0x8700,
+	0x0805: 0x8801,
+}
+
+// ReplyOf reports the serial number and msg id of the request which m is a
+// response to, ok is false if m is not a response.
+func ReplyOf(m *Msg) (replySN uint16, replyID uint16, ok bool) {
+	if m.PartIndex > 1 {
+		return 0, 0, false // only the first part carries reply fields
+	}
+	switch m.MsgID {
+	case 0x0001, 0x8001:
+		if len(m.Body) < 4 {
+			return 0, 0, false
+		}
+		return binary.BigEndian.Uint16(m.Body[0:2]), binary.BigEndian.Uint16(m.Body[2:4]), true
+	}
+	if id, found := replyTargets[m.MsgID]; found && len(m.Body) >= 2 {
+		return binary.BigEndian.Uint16(m.Body[0:2]), id, true
+	}
+	return 0, 0, false
+}
+
+func isResponseMsgID(id uint16) bool {
+	_, found := replyTargets[id]
+	return found || id == 0x0001 || id == 0x8001
+}
+
+// Counterparts lists the msg ids of the requests a msg of id may answer, or
+// of the responses it may get if it is a request. General responses may
+// answer any request, which ReplyOf finds in their body, so nil is returned
+// for them.
+func Counterparts(id uint16) []uint16 {
+	if id == 0x0001 || id == 0x8001 {
+		return nil
+	}
+	if req, found := replyTargets[id]; found {
+		return []uint16{req}
+	}
+	ids := []uint16{0x0001, 0x8001}
+	for resp, req := range replyTargets {
+		if req == id {
+			ids = append(ids, resp)
+		}
+	}
+	return ids
+}
+
+type CorrelatedMsg struct {
+	Key        *MsgKey
+	Msg        *Msg
+	ResponseTo *CorrelatedMsg
+	Responses  []*CorrelatedMsg
+	Latency    time.Duration
+	Unanswered bool
+	Orphan     bool
+}
+
+// IsRequest reports whether cm is expected to be answered by the peer.
+func (cm *CorrelatedMsg) IsRequest() bool {
+	return !isResponseMsgID(cm.Msg.MsgID)
+}
+
+type correlationKey struct {
+	TX    bool
+	MsgSN uint16
+	MsgID uint16
+}
+
+// Correlator pairs requests and responses of one terminal by MsgSN. Messages
+// must be added in the order they were transferred, as MsgDB.Iterate does.
+type Correlator struct {
+	window  time.Duration
+	pending map[correlationKey]*CorrelatedMsg
+	msgs    []*CorrelatedMsg
+}
+
+// NewCorrelator creates a Correlator, responses arriving later than window
+// after their request are treated as orphans, zero window means no limit.
+func NewCorrelator(window time.Duration) *Correlator {
+	return &Correlator{
+		window:  window,
+		pending: make(map[correlationKey]*CorrelatedMsg),
+		msgs:    make([]*CorrelatedMsg, 0),
+	}
+}
+
+func (c *Correlator) Add(mk *MsgKey, m *Msg) *CorrelatedMsg {
+	cm := &CorrelatedMsg{Key: mk, Msg: m}
+	c.msgs = append(c.msgs, cm)
+	if replySN, replyID, ok := ReplyOf(m); ok {
+		req, found := c.pending[correlationKey{TX: !mk.TX, MsgSN: replySN, MsgID: replyID}]
+		if found && c.window > 0 && mk.Timestamp.Sub(req.Key.Timestamp) > c.window {
+			found = false
+		}
+		if !found {
+			cm.Orphan = true
+			return cm
+		}
+		cm.ResponseTo = req
+		cm.Latency = mk.Timestamp.Sub(req.Key.Timestamp)
+		req.Responses = append(req.Responses, cm)
+		return cm
+	}
+	if cm.IsRequest() {
+		c.pending[correlationKey{TX: mk.TX, MsgSN: m.MsgSN, MsgID: m.MsgID}] = cm
+	}
+	return cm
+}
+
+// Expire drops the messages which are more than window before t, as later
+// responses no longer pair with them, flags the requests among them which
+// got no response and returns them in order. Nothing expires without window.
+func (c *Correlator) Expire(t time.Time) []*CorrelatedMsg {
+	if c.window <= 0 {
+		return nil
+	}
+	n := 0
+	for n < len(c.msgs) && t.Sub(c.msgs[n].Key.Timestamp) > c.window {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	expired := make([]*CorrelatedMsg, n)
+	copy(expired, c.msgs)
+	for i, cm := range expired {
+		cm.Unanswered = cm.IsRequest() && len(cm.Responses) == 0
+		key := correlationKey{TX: cm.Key.TX, MsgSN: cm.Msg.MsgSN, MsgID: cm.Msg.MsgID}
+		if c.pending[key] == cm {
+			delete(c.pending, key)
+		}
+		c.msgs[i] = nil
+	}
+	c.msgs = c.msgs[n:]
+	return expired
+}
+
+// Finish flags the requests which got no response and returns all messages
+// added so far in order, but the expired ones.
+func (c *Correlator) Finish() []*CorrelatedMsg {
+	for _, cm := range c.msgs {
+		cm.Unanswered = cm.IsRequest() && len(cm.Responses) == 0
+	}
+	return c.msgs
+}
@@ -0,0 +1,80 @@
+package msg
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCorrelator(t *testing.T) {
+	now := time.Now()
+	add := func(c *Correlator, offset time.Duration, tx bool, id, sn uint16, body string) *CorrelatedMsg {
+		return c.Add(
+			&MsgKey{Timestamp: now.Add(offset), TX: tx, MsgID: id},
+			&Msg{MsgID: id, MsgSN: sn, PartTotal: 1, PartIndex: 1, Body: mustDecodeHexString(body)},
+		)
+	}
+	c := NewCorrelator(10 * time.Second)
+	req := add(c, 0, false, 0x0200, 7, "")
+	resp := add(c, time.Second, true, 0x8001, 100, "00 07 02 00 00")
+	orphan := add(c, 2*time.Second, true, 0x8001, 101, "00 08 02 00 00")
+	cmd := add(c, 3*time.Second, true, 0x8104, 102, "")
+	late := add(c, 30*time.Second, false, 0x0104, 8, "00 66")
+	c.Finish()
+
+	if resp.ResponseTo != req || len(req.Responses) != 1 || resp.Latency != time.Second {
+		t.Errorf("0200 not paired with 8001")
+	}
+	if req.Unanswered || resp.Unanswered || resp.Orphan {
+		t.Errorf("paired msgs flagged")
+	}
+	if !orphan.Orphan {
+		t.Errorf("orphan 8001 not flagged")
+	}
+	if !cmd.Unanswered || !late.Orphan {
+		t.Errorf("response out of window paired")
+	}
+}
+
+func TestCounterparts(t *testing.T) {
+	for _, tc := range []struct {
+		id   uint16
+		want []uint16
+	}{
+		{0x0001, nil},
+		{0x8001, nil},
+		{0x8100, []uint16{0x0100}},
+		{0x0100, []uint16{0x0001, 0x8001, 0x8100}},
+		{0x0200, []uint16{0x0001, 0x8001}},
+	} {
+		if got := Counterparts(tc.id); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%04x: %v, want %v", tc.id, got, tc.want)
+		}
+	}
+}
+
+func TestCorrelatorExpire(t *testing.T) {
+	now := time.Now()
+	add := func(c *Correlator, offset time.Duration, tx bool, id, sn uint16, body string) *CorrelatedMsg {
+		mk := &MsgKey{Timestamp: now.Add(offset), TX: tx, MsgID: id}
+		c.Expire(mk.Timestamp)
+		return c.Add(mk, &Msg{MsgID: id, MsgSN: sn, PartTotal: 1, PartIndex: 1, Body: mustDecodeHexString(body)})
+	}
+	c := NewCorrelator(10 * time.Second)
+	req := add(c, 0, false, 0x0200, 7, "")
+	cmd := add(c, time.Second, true, 0x8104, 102, "")
+	add(c, 5*time.Second, true, 0x8001, 100, "00 07 02 00 00")
+	expired := c.Expire(now.Add(12 * time.Second))
+	if len(expired) != 2 || expired[0] != req || expired[1] != cmd {
+		t.Fatalf("expired %v", expired)
+	}
+	if req.Unanswered || !cmd.Unanswered {
+		t.Errorf("expired requests flagged %v %v", req.Unanswered, cmd.Unanswered)
+	}
+	if late := add(c, 13*time.Second, false, 0x0104, 8, "00 66"); !late.Orphan {
+		t.Errorf("response to expired request paired")
+	}
+	if msgs := c.Finish(); len(msgs) != 2 {
+		t.Errorf("%d msgs left, want 2", len(msgs))
+	}
+}
@@ -0,0 +1,159 @@
+package msg
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogFormat describes the lines of a codec log. Pattern must capture the
+// "timestamp", "xfer" and "payload" groups, every other named group is kept
+// in Msg.Extra.
+type LogFormat struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+const DefaultLogFormat = "default"
+
+const (
+	logTimestamp = `(?P<timestamp>\d{14}(?:\.\d{1,9})?|\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d{1,9})?(?:Z|[+-]\d{2}:?\d{2})?)`
+	logXfer      = `(?P<xfer>(?i:rx|tx))`
+	logPayload   = `(?P<payload>[0-9A-Fa-f]{2}(?: ?[0-9A-Fa-f]{2})*)`
+	logPeer      = `(?P<peer>(?:\d{1,3}\.){3}\d{1,3}:\d+|\[[0-9A-Fa-f:.]+\]:\d+)`
+	logConn      = `\[?(?P<conn>[\w.:-]+?)\]?`
+)
+
+var logFormatPresets = map[string]string{
+	DefaultLogFormat: `^(?P<timestamp>\d{14}(?:\.\d{1,9})?) (?P<xfer>Rx|Tx) (?P<payload>[a-f0-9]+)$`,
+	"iso8601":        `^` + logTimestamp + `\s+` + logXfer + `\s+` + logPayload + `$`,
+	"conn":           `^` + logTimestamp + `\s+` + logConn + `\s+` + logXfer + `\s+` + logPayload + `$`,
+	"peer":           `^` + logTimestamp + `\s+` + logXfer + `\s+` + logPeer + `\s+` + logPayload + `$`,
+	"conn-peer":      `^` + logTimestamp + `\s+` + logConn + `\s+` + logPeer + `\s+` + logXfer + `\s+` + logPayload + `$`,
+}
+
+var logTimestampLayouts = []string{
+	"20060102150405",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05Z0700",
+	"2006-01-02 15:04:05",
+}
+
+var (
+	logFormatsLock sync.RWMutex
+	logFormats     = make(map[string]*LogFormat)
+)
+
+var (
+	ErrUnknownLogFormat = errors.New("unknown log format")
+	ErrLogFormat        = errors.New("invalid log format")
+	ErrLogTimestamp     = errors.New("invalid log timestamp")
+	ErrLogPayload       = errors.New("invalid log payload")
+)
+
+func init() {
+	for name, pattern := range logFormatPresets {
+		if err := RegisterLogFormat(name, pattern); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterLogFormat compiles pattern and registers it as the format name,
+// a registered format of the same name is replaced.
+func RegisterLogFormat(name, pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("log format %s: %w", name, err)
+	}
+	for _, group := range []string{"timestamp", "xfer", "payload"} {
+		if re.SubexpIndex(group) < 0 {
+			return fmt.Errorf("log format %s: missing group '%s'", name, group)
+		}
+	}
+	logFormatsLock.Lock()
+	defer logFormatsLock.Unlock()
+	logFormats[name] = &LogFormat{Name: name, Pattern: re}
+	return nil
+}
+
+func LookupLogFormat(name string) (*LogFormat, error) {
+	logFormatsLock.RLock()
+	defer logFormatsLock.RUnlock()
+	lf, ok := logFormats[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLogFormat, name)
+	}
+	return lf, nil
+}
+
+// ParseLog parses a line of the default log format, timestamps without zone
+// are interpreted in DefaultLocation.
+func ParseLog(log string, ds uint8, sn uint32) (*Msg, *MsgKey, error) {
+	lf, err := LookupLogFormat(DefaultLogFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lf.Parse(log, ds, sn)
+}
+
+func (lf *LogFormat) Parse(log string, ds uint8, sn uint32) (*Msg, *MsgKey, error) {
+	return lf.ParseInLocation(log, DefaultLocation, ds, sn)
+}
+
+// ParseInLocation is like Parse but interprets timestamps without zone in
+// loc.
+func (lf *LogFormat) ParseInLocation(log string, loc *time.Location, ds uint8, sn uint32) (*Msg, *MsgKey, error) {
+	matches := lf.Pattern.FindStringSubmatch(log)
+	if matches == nil {
+		return nil, nil, ErrLogFormat
+	}
+	fields := make(map[string]string)
+	for i, name := range lf.Pattern.SubexpNames() {
+		if i != 0 && name != "" && matches[i] != "" {
+			fields[name] = matches[i]
+		}
+	}
+	timestamp, err := parseLogTimestamp(fields["timestamp"], loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrLogTimestamp, err)
+	}
+	payload, err := hex.DecodeString(strings.ReplaceAll(fields["payload"], " ", ""))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrLogPayload, err)
+	}
+	m, err := Decode(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, value := range fields {
+		switch name {
+		case "timestamp", "xfer", "payload":
+		default:
+			if m.Extra == nil {
+				m.Extra = make(map[string]string)
+			}
+			m.Extra[name] = value
+		}
+	}
+	return m, newMsgKey(m, timestamp, strings.EqualFold(fields["xfer"], "Tx"), ds, sn), nil
+}
+
+func parseLogTimestamp(s string, loc *time.Location) (time.Time, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	var err error
+	for _, layout := range logTimestampLayouts {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
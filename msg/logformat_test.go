@@ -0,0 +1,74 @@
+package msg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogFormatPresets(t *testing.T) {
+	ts := mustParseInLocation("2006-01-02 15:04:05.000", "2023-04-25 11:01:39.250", time.Local)
+	cases := []struct {
+		format string
+		line   string
+		tx     bool
+		extra  map[string]string
+	}{
+		{"iso8601", "2023-04-25T11:01:39.250 TX 7E 00 02 00 00 01 38 00 13 80 00 00 01 A9 7E", true, nil},
+		{"iso8601", "2023-04-25 11:01:39,250 rx 7E000200000138001380000001A97E", false, nil},
+		{"conn", "20230425110139.250 [conn-42] Rx 7e000200000138001380000001a97e", false, map[string]string{"conn": "conn-42"}},
+		{"peer", "2023-04-25 11:01:39.250 Rx 10.0.0.1:52011 7e000200000138001380000001a97e", false, map[string]string{"peer": "10.0.0.1:52011"}},
+		{"conn-peer", "2023-04-25 11:01:39.250 17 [::1]:52011 Tx 7e000200000138001380000001a97e", true, map[string]string{"conn": "17", "peer": "[::1]:52011"}},
+	}
+	for _, c := range cases {
+		lf, err := LookupLogFormat(c.format)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		m, mk, err := lf.Parse(c.line, 0, 0)
+		if err != nil {
+			t.Errorf("%s: %v", c.line, err)
+			continue
+		}
+		if !mk.Timestamp.Equal(ts) || mk.TX != c.tx || m.MsgID != 0x0002 {
+			t.Errorf("%s: bad parse result: %+v", c.line, mk)
+		}
+		if b1, b2, eq := mustMarshalEqual(m.Extra, c.extra); !eq {
+			t.Errorf("%s: extra mismatch:\n\t%s\n\t%s\n", c.line, b1, b2)
+		}
+	}
+	zoned, _ := LookupLogFormat("iso8601")
+	_, mk, err := zoned.Parse("2023-04-25T03:01:39Z rx 7E000200000138001380000001A97E", 0, 0)
+	if err != nil || !mk.Timestamp.Equal(time.Date(2023, 4, 25, 3, 1, 39, 0, time.UTC)) {
+		t.Errorf("zoned timestamp: %v, %v", mk, err)
+	}
+}
+
+func TestRegisterLogFormat(t *testing.T) {
+	if err := RegisterLogFormat("bad", `^(?P<timestamp>\d+) (?P<payload>\w+)$`); err == nil {
+		t.Errorf("format without xfer registered")
+	}
+	if err := RegisterLogFormat("custom", `^(?P<timestamp>\d{14}) (?P<gw>\w+) (?P<xfer>Rx|Tx): (?P<payload>\w+)$`); err != nil {
+		t.Error(err)
+		return
+	}
+	lf, _ := LookupLogFormat("custom")
+	m, _, err := lf.Parse("20230425110139 gw1 Rx: 7e000200000138001380000001a97e", 0, 0)
+	if err != nil || m.Extra["gw"] != "gw1" {
+		t.Errorf("custom format: %v, %v", m, err)
+	}
+}
+
+func TestParseLogDefaultLocation(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*3600)
+	defer func(l *time.Location) { DefaultLocation = l }(DefaultLocation)
+	DefaultLocation = loc
+	_, mk, err := ParseLog("20230425110139 Rx 7e000200000138001380000001a97e", 0, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mk.Timestamp.Equal(time.Date(2023, 4, 25, 11, 1, 39, 0, loc)) {
+		t.Errorf("timestamp not in default location: %s", mk.Timestamp)
+	}
+}
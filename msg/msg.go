@@ -6,7 +6,6 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 )
@@ -22,6 +21,50 @@ type Msg struct {
 	PartIndex uint16
 	Body      []byte
 	Warnings  []string
+	Extra     map[string]string // fields captured from the log line besides the msg
+}
+
+// DefaultLocation is the zone of log timestamps without offset, unless the
+// source has its own tz tag. It is Local unless the zone is configured.
+var DefaultLocation = time.Local
+
+// BodyLocation is the zone of the BCD times in msg bodies when the zone of
+// the source is unknown, GMT+8 as the protocol defines.
+var BodyLocation = time.FixedZone("GMT+8", 8*60*60)
+
+// Well-known keys of Msg.Extra.
+const (
+	ExtraPeer = "peer" // remote ip:port of the terminal
+	ExtraConn = "conn" // connection id assigned by the gateway
+	ExtraHost = "host" // host which shipped the log line
+	ExtraFile = "file" // log file the line was read from
+	ExtraTZ   = "tz"   // zone of the source, see Location
+)
+
+// Peer returns the remote address the msg was transferred over, if known.
+func (m *Msg) Peer() string {
+	return m.Extra[ExtraPeer]
+}
+
+// Location returns the zone of the source which logged the msg, which is
+// the zone of the BCD times in its body. Without a zone of its own, it is
+// DefaultLocation if set, else BodyLocation.
+func (m *Msg) Location() *time.Location {
+	if name := m.Extra[ExtraTZ]; name != "" {
+		if loc, err := loadLocation(name); err == nil {
+			return loc
+		}
+	}
+	if DefaultLocation != time.Local {
+		return DefaultLocation
+	}
+	return BodyLocation
+}
+
+// ConnID returns the gateway connection id the msg was transferred over, if
+// known.
+func (m *Msg) ConnID() string {
+	return m.Extra[ExtraConn]
 }
 
 var (
@@ -29,7 +72,12 @@ var (
 	ErrBadMsg   = errors.New("bad msg")
 )
 
-var logPattern = regexp.MustCompile(`^(?P<timestamp>\d{14}) (?P<xfer>Rx|Tx) (?P<payload>[a-f0-9]+)$`)
+const (
+	bodyLengthMask    uint16 = 0x03FF
+	attrEncryptRSA    uint16 = 0x0400
+	attrSubpackage    uint16 = 0x2000
+	attrVersionMarker uint16 = 0x4000
+)
 
 func Decode(raw []byte) (*Msg, error) {
 	m := &Msg{Raw: raw, Warnings: make([]string, 0)}
@@ -78,10 +126,10 @@ func Decode(raw []byte) (*Msg, error) {
 	}
 
 	// read encrypt bits
-	m.Encrypted = (attribute & 0x0400) != 0
+	m.Encrypted = (attribute & attrEncryptRSA) != 0
 
 	// read version
-	if (attribute & 0x4000) != 0 {
+	if (attribute & attrVersionMarker) != 0 {
 		var version uint8
 		if err := binary.Read(buf, binary.BigEndian, &version); err != nil {
 			return nil, fmt.Errorf("invalid version: %w", err)
@@ -107,7 +155,7 @@ func Decode(raw []byte) (*Msg, error) {
 	}
 
 	// read split info
-	if (attribute & 0x2000) != 0 {
+	if (attribute & attrSubpackage) != 0 {
 		if err := binary.Read(buf, binary.BigEndian, &m.PartTotal); err != nil {
 			return nil, fmt.Errorf("invalid msgPartTotal: %w", err)
 		}
@@ -121,7 +169,7 @@ func Decode(raw []byte) (*Msg, error) {
 
 	// read msg body
 	remain := buf.Len()
-	if int(attribute&0x03FF) != remain-1 {
+	if int(attribute&bodyLengthMask) != remain-1 {
 		m.Warnings = append(m.Warnings, "bad body length")
 	}
 	if remain > 1 {
@@ -140,38 +188,69 @@ func Decode(raw []byte) (*Msg, error) {
 	return m, nil
 }
 
-func ParseLog(log string, ds uint8, sn uint32) (*Msg, *MsgKey, error) {
-	matches := logPattern.FindStringSubmatch(log)
-	if matches == nil {
-		return nil, nil, errors.New("invalid log format")
+// Encode builds the escaped frame of m, the 2019 header layout is used if
+// m.Version is not -1. Raw and Warnings of m are ignored.
+func Encode(m *Msg) ([]byte, error) {
+	if len(m.Body) > int(bodyLengthMask) {
+		return nil, fmt.Errorf("body too long (%d bytes)", len(m.Body))
 	}
-	fields := make(map[string]string)
-	for i, name := range logPattern.SubexpNames() {
-		if i != 0 && name != "" {
-			fields[name] = matches[i]
-		}
+	if m.Version < -1 || m.Version > 0xFF {
+		return nil, fmt.Errorf("invalid version: %d", m.Version)
 	}
-	timestamp, err := time.ParseInLocation("20060102150405", fields["timestamp"], time.Local)
-	if err != nil {
-		return nil, nil, fmt.Errorf("invalid log timestamp: %w", err)
+	attribute := uint16(len(m.Body))
+	if m.Encrypted {
+		attribute |= attrEncryptRSA
 	}
-	payload, err := hex.DecodeString(fields["payload"])
-	if err != nil {
-		return nil, nil, fmt.Errorf("invalid log payload: %w", err)
+	if m.PartTotal > 1 {
+		attribute |= attrSubpackage
+	}
+	simNoBytes := 6
+	if m.Version != -1 {
+		attribute |= attrVersionMarker
+		simNoBytes = 10
 	}
-	m, err := Decode(payload)
+	if len(m.SimNo) > simNoBytes*2 {
+		return nil, fmt.Errorf("simNo too long (>%d chars)", simNoBytes*2)
+	}
+	simNo, err := hex.DecodeString(strings.Repeat("0", simNoBytes*2-len(m.SimNo)) + m.SimNo)
 	if err != nil {
-		return nil, nil, err
-	}
-	mk := &MsgKey{
-		SimNo:     m.SimNo,
-		Timestamp: timestamp,
-		TX:        fields["xfer"] == "Tx",
-		DS:        ds,
-		SN:        sn,
-		MsgID:     m.MsgID,
-		PartIndex: m.PartIndex,
-		PartTotal: m.PartTotal,
-	}
-	return m, mk, nil
+		return nil, fmt.Errorf("simNo contains non-hex chars: %w", err)
+	}
+
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.BigEndian, m.MsgID)
+	_ = binary.Write(buf, binary.BigEndian, attribute)
+	if m.Version != -1 {
+		buf.WriteByte(uint8(m.Version))
+	}
+	buf.Write(simNo)
+	_ = binary.Write(buf, binary.BigEndian, m.MsgSN)
+	if m.PartTotal > 1 {
+		_ = binary.Write(buf, binary.BigEndian, m.PartTotal)
+		_ = binary.Write(buf, binary.BigEndian, m.PartIndex)
+	}
+	buf.Write(m.Body)
+
+	// checksum
+	var checksum uint8
+	for _, b := range buf.Bytes() {
+		checksum ^= b
+	}
+	buf.WriteByte(checksum)
+
+	// escape
+	raw := make([]byte, 0, buf.Len()+2)
+	raw = append(raw, 0x7E)
+	for _, b := range buf.Bytes() {
+		switch b {
+		case 0x7D:
+			raw = append(raw, 0x7D, 0x01)
+		case 0x7E:
+			raw = append(raw, 0x7D, 0x02)
+		default:
+			raw = append(raw, b)
+		}
+	}
+	raw = append(raw, 0x7E)
+	return raw, nil
 }
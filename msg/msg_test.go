@@ -0,0 +1,88 @@
+package msg
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	msgs := []*Msg{
+		{MsgID: 0x0200, MsgSN: 0x7E7D, SimNo: "13800138000", Version: -1, PartTotal: 1, PartIndex: 1, Body: mustDecodeHexString("7E 7D 01 02")},
+		{MsgID: 0x0100, MsgSN: 1, SimNo: "12345678901234567890", Version: 1, PartTotal: 1, PartIndex: 1, Body: []byte{}},
+		{MsgID: 0x0801, MsgSN: 2, SimNo: "13800138000", Version: -1, Encrypted: true, PartTotal: 3, PartIndex: 2, Body: mustDecodeHexString("00 11 22")},
+	}
+	for _, m := range msgs {
+		raw, err := Encode(m)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if bytes.Count(raw, []byte{0x7E}) != 2 {
+			t.Errorf("unescaped frame: %X", raw)
+		}
+		decoded, err := Decode(raw)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		expected := *m
+		expected.Raw = raw
+		expected.Warnings = []string{}
+		if b1, b2, eq := mustMarshalEqual(decoded, expected); !eq {
+			t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+		}
+	}
+}
+
+func TestEncodeDecoded(t *testing.T) {
+	raw := mustDecodeHexString(
+		"7E 02 00 00 45 06 46 18 21 63 87 0A 3C 00 00 80 26 02 0C 00 01 02 5E 3E 99 07 16 78 66 00 00 00 00 00 00 23 08 16 14 04 11 01 04 00 BB F9 27 02 02 00 00 03 02 00 D7 11 01 00 25 04 00 00 00 00 2B 04 00 06 00 05 30 01 0E 31 01 00 E0 04 E4 02 04 1A 35 7E",
+	)
+	m, err := Decode(raw)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	encoded, err := Encode(m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(raw, encoded) {
+		t.Errorf("mismatch:\n\t%X\n\t%X\n", raw, encoded)
+	}
+	body, err := DecodeBody_0200(m.Body, BodyLocation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	encodedBody, err := EncodeBody_0200(body, BodyLocation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(m.Body, encodedBody) {
+		t.Errorf("mismatch:\n\t%X\n\t%X\n", m.Body, encodedBody)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	if _, err := Encode(&Msg{SimNo: "1234567890123", Version: -1}); err == nil {
+		t.Errorf("13 digits simNo encoded in 2013 header")
+	}
+	if _, err := Encode(&Msg{SimNo: "1", Version: -1, Body: make([]byte, 0x400)}); err == nil {
+		t.Errorf("oversized body encoded")
+	}
+}
+
+func TestParseLog(t *testing.T) {
+	m, mk, err := ParseLog("20230425110139.250 Rx 7e000200000138001380000001a97e", 1, 2)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if m.MsgID != 0x0002 || len(m.Warnings) != 0 || !mk.Timestamp.Equal(mustParseInLocation("2006-01-02 15:04:05.000", "2023-04-25 11:01:39.250", time.Local)) || mk.TX {
+		t.Errorf("bad parse result: %+v, %+v", m, mk)
+	}
+}
@@ -0,0 +1,27 @@
+package msg
+
+import (
+	"testing"
+)
+
+func TestDecodeBody_0001(t *testing.T) {
+	body, err := DecodeBody_0001(mustDecodeHexString(
+		"12 34",
+		"02 00",
+		"02",
+	))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := MsgBody_0001{
+		ReplySN:    0x1234,
+		ReplyID:    0x0200,
+		Result:     2,
+		ResultText: "bad message",
+		Warnings:   []string{},
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
@@ -0,0 +1,69 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type MsgBody_0100 struct {
+	ProvinceID     uint16   `json:"provinceId"`
+	CityID         uint16   `json:"cityId"`
+	ManufacturerID string   `json:"manufacturerId"`
+	TerminalModel  string   `json:"terminalModel"`
+	TerminalID     string   `json:"terminalId"`
+	PlateColor     uint8    `json:"plateColor"`
+	PlateNo        string   `json:"plateNo"`
+	Warnings       []string `json:"warnings"`
+}
+
+// DecodeBody_0100 decodes a terminal registration, field widths of the
+// manufacturer id, terminal model and terminal id depend on the protocol
+// version (-1 for 2013, 1 and above for 2019).
+func DecodeBody_0100(raw []byte, version int16) (*MsgBody_0100, error) {
+	widths := [3]int{5, 20, 7}
+	if version >= 1 {
+		widths = [3]int{11, 30, 30}
+	}
+	var common struct {
+		ProvinceID uint16
+		CityID     uint16
+	}
+	warnings := make([]string, 0)
+	buf := bytes.NewReader(raw)
+	if err := binary.Read(buf, binary.BigEndian, &common); err != nil {
+		return nil, err
+	}
+	fields := make([]string, len(widths))
+	for i, width := range widths {
+		data := make([]byte, width)
+		if _, err := io.ReadFull(buf, data); err != nil {
+			return nil, err
+		}
+		s, err := decodeString(data)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("bad string in 0100 body '%X': %v", data, err))
+		}
+		fields[i] = s
+	}
+	var plateColor uint8
+	if err := binary.Read(buf, binary.BigEndian, &plateColor); err != nil {
+		return nil, err
+	}
+	plateData, _ := io.ReadAll(buf)
+	plateNo, err := decodeString(plateData)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("bad plate no in 0100 body '%X': %v", plateData, err))
+	}
+	return &MsgBody_0100{
+		ProvinceID:     common.ProvinceID,
+		CityID:         common.CityID,
+		ManufacturerID: fields[0],
+		TerminalModel:  fields[1],
+		TerminalID:     fields[2],
+		PlateColor:     plateColor,
+		PlateNo:        plateNo,
+		Warnings:       warnings,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package msg
+
+import (
+	"testing"
+)
+
+func TestDecodeBody_0100(t *testing.T) {
+	body, err := DecodeBody_0100(mustDecodeHexString(
+		"00 2C",
+		"01 2C",
+		"37 30 31 31 31",
+		"4D 4F 44 45 4C 31 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+		"54 45 52 4D 30 30 31",
+		"01",
+		"D4 C1 42 31 32 33 34 35",
+	), -1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := MsgBody_0100{
+		ProvinceID:     44,
+		CityID:         300,
+		ManufacturerID: "70111",
+		TerminalModel:  "MODEL1",
+		TerminalID:     "TERM001",
+		PlateColor:     1,
+		PlateNo:        "粤B12345",
+		Warnings:       []string{},
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
+
+func TestDecodeBody_0100_2019(t *testing.T) {
+	body, err := DecodeBody_0100(mustDecodeHexString(
+		"00 2C",
+		"01 2C",
+		"37 30 31 31 31 00 00 00 00 00 00",
+		"4D 4F 44 45 4C 31 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+		"54 45 52 4D 30 30 31 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+		"02",
+		"D4 C1 42 31 32 33 34 35",
+	), 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := MsgBody_0100{
+		ProvinceID:     44,
+		CityID:         300,
+		ManufacturerID: "70111",
+		TerminalModel:  "MODEL1",
+		TerminalID:     "TERM001",
+		PlateColor:     2,
+		PlateNo:        "粤B12345",
+		Warnings:       []string{},
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
@@ -0,0 +1,55 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type MsgBody_0102 struct {
+	AuthCode        string   `json:"authCode"`
+	IMEI            string   `json:"imei"`
+	SoftwareVersion string   `json:"softwareVersion"`
+	Warnings        []string `json:"warnings"`
+}
+
+// DecodeBody_0102 decodes a terminal authentication, the 2013 body is the
+// bare auth code while the 2019 one (version 1 and above) is length prefixed
+// and followed by IMEI and software version.
+func DecodeBody_0102(raw []byte, version int16) (*MsgBody_0102, error) {
+	warnings := make([]string, 0)
+	if version < 1 {
+		authCode, err := decodeString(raw)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("bad auth code in 0102 body '%X': %v", raw, err))
+		}
+		return &MsgBody_0102{AuthCode: authCode, Warnings: warnings}, nil
+	}
+	buf := bytes.NewReader(raw)
+	var authLen uint8
+	if err := binary.Read(buf, binary.BigEndian, &authLen); err != nil {
+		return nil, err
+	}
+	fields := make([]string, 3)
+	for i, width := range []int{int(authLen), 15, 20} {
+		data := make([]byte, width)
+		if _, err := io.ReadFull(buf, data); err != nil {
+			return nil, err
+		}
+		s, err := decodeString(data)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("bad string in 0102 body '%X': %v", data, err))
+		}
+		fields[i] = s
+	}
+	if buf.Len() != 0 {
+		warnings = append(warnings, "bad tailing bytes")
+	}
+	return &MsgBody_0102{
+		AuthCode:        fields[0],
+		IMEI:            fields[1],
+		SoftwareVersion: fields[2],
+		Warnings:        warnings,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package msg
+
+import (
+	"testing"
+)
+
+func TestDecodeBody_0102(t *testing.T) {
+	body, err := DecodeBody_0102(mustDecodeHexString("41 42 43 31 32 33"), -1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := MsgBody_0102{
+		AuthCode: "ABC123",
+		Warnings: []string{},
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
+
+func TestDecodeBody_0102_2019(t *testing.T) {
+	body, err := DecodeBody_0102(mustDecodeHexString(
+		"06",
+		"41 42 43 31 32 33",
+		"38 36 31 32 33 34 35 36 37 38 39 30 31 32 33",
+		"56 31 2E 30 2E 32 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+	), 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := MsgBody_0102{
+		AuthCode:        "ABC123",
+		IMEI:            "861234567890123",
+		SoftwareVersion: "V1.0.2",
+		Warnings:        []string{},
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
@@ -4,34 +4,43 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 )
 
 type MsgBody_0200 struct {
-	Alarm         uint32
-	Status        uint32
-	Latitude      float64
-	Longitude     float64
-	Altitude      uint16
-	Speed         float64
-	Direction     uint16
-	Time          time.Time
-	ExtInfo       []*MsgBody_0200_ExtInfo
-	ParsedExtInfo MsgBody_0200_ParsedExtInfo
-	Warnings      []string
+	Alarm         uint32                     `json:"alarm"`
+	AlarmFlags    []string                   `json:"alarmFlags"`
+	Status        uint32                     `json:"status"`
+	StatusFlags   []string                   `json:"statusFlags"`
+	Latitude      float64                    `json:"latitude"`
+	Longitude     float64                    `json:"longitude"`
+	Altitude      uint16                     `json:"altitude"`
+	Speed         float64                    `json:"speed"`
+	Direction     uint16                     `json:"direction"`
+	Time          time.Time                  `json:"time"`
+	ExtInfo       []*MsgBody_0200_ExtInfo    `json:"extInfo"`
+	ParsedExtInfo MsgBody_0200_ParsedExtInfo `json:"-"`
+	Warnings      []string                   `json:"warnings"`
 }
 
 type MsgBody_0200_ExtInfo struct {
-	ID   uint8
-	Data []byte
+	ID   uint8  `json:"id"`
+	Data []byte `json:"data"`
 }
 
-type MsgBody_0200_ParsedExtInfo struct {
-	Mileage float64
+// MarshalJSON inlines the parsed ext info items into the body.
+func (b MsgBody_0200) MarshalJSON() ([]byte, error) {
+	type body MsgBody_0200
+	return json.Marshal(struct {
+		body
+		MsgBody_0200_ParsedExtInfo
+	}{body(b), b.ParsedExtInfo})
 }
 
-func DecodeBody_0200(raw []byte) (*MsgBody_0200, error) {
+func DecodeBody_0200(raw []byte, loc *time.Location) (*MsgBody_0200, error) {
 	var common struct {
 		Alarm     uint32
 		Status    uint32
@@ -69,19 +78,20 @@ func DecodeBody_0200(raw []byte) (*MsgBody_0200, error) {
 			ID:   id,
 			Data: data,
 		})
-		switch id {
-		case 0x01:
-			parsedExtInfo.Mileage = float64(binary.BigEndian.Uint32(data)) / 10
+		if err := parsedExtInfo.parse(id, data, loc); err != nil {
+			warnings = append(warnings, fmt.Sprintf("bad ext info 0x%02X in 0200 body '%X': %v", id, data, err))
 		}
 	}
 	bcdTime := hex.EncodeToString(common.Time[:])
-	time, err := time.ParseInLocation("20060102150405", "20"+bcdTime, time.Local)
+	time, err := time.ParseInLocation("20060102150405", "20"+bcdTime, loc)
 	if err != nil {
 		warnings = append(warnings, fmt.Sprintf("bad time in 0200 body '%s': %v", bcdTime, err))
 	}
 	return &MsgBody_0200{
 		Alarm:         common.Alarm,
+		AlarmFlags:    AlarmFlags_0200(common.Alarm),
 		Status:        common.Status,
+		StatusFlags:   StatusFlags_0200(common.Status),
 		Latitude:      float64(common.Latitude) / 1000000,
 		Longitude:     float64(common.Longitude) / 1000000,
 		Altitude:      common.Altitude,
@@ -93,3 +103,42 @@ func DecodeBody_0200(raw []byte) (*MsgBody_0200, error) {
 		Warnings:      warnings,
 	}, nil
 }
+
+// EncodeBody_0200 encodes b with its time in loc, ext info items are taken
+// from ExtInfo only.
+func EncodeBody_0200(b *MsgBody_0200, loc *time.Location) ([]byte, error) {
+	bcdTime, err := hex.DecodeString(b.Time.In(loc).Format("060102150405"))
+	if err != nil {
+		return nil, fmt.Errorf("bad time in 0200 body: %w", err)
+	}
+	common := struct {
+		Alarm     uint32
+		Status    uint32
+		Latitude  uint32
+		Longitude uint32
+		Altitude  uint16
+		Speed     uint16
+		Direction uint16
+		Time      [6]byte
+	}{
+		Alarm:     b.Alarm,
+		Status:    b.Status,
+		Latitude:  uint32(math.Round(b.Latitude * 1000000)),
+		Longitude: uint32(math.Round(b.Longitude * 1000000)),
+		Altitude:  b.Altitude,
+		Speed:     uint16(math.Round(b.Speed * 10)),
+		Direction: b.Direction,
+	}
+	copy(common.Time[:], bcdTime)
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.BigEndian, &common)
+	for _, it := range b.ExtInfo {
+		if len(it.Data) > 0xFF {
+			return nil, fmt.Errorf("ext info 0x%02X too long (%d bytes)", it.ID, len(it.Data))
+		}
+		buf.WriteByte(it.ID)
+		buf.WriteByte(uint8(len(it.Data)))
+		buf.Write(it.Data)
+	}
+	return buf.Bytes(), nil
+}
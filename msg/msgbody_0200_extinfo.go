@@ -0,0 +1,155 @@
+package msg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// MsgBody_0200_ParsedExtInfo holds the standard ext info items of a 0200
+// body, items absent from the body are left nil.
+type MsgBody_0200_ParsedExtInfo struct {
+	Mileage             float64                       `json:"mileage"`                      // 0x01, km
+	Fuel                *float64                      `json:"fuel,omitempty"`               // 0x02, L
+	RecorderSpeed       *float64                      `json:"recorderSpeed,omitempty"`      // 0x03, km/h
+	ManualAlarmEventID  *uint16                       `json:"manualAlarmEventId,omitempty"` // 0x04
+	OverspeedAlarm      *MsgBody_0200_OverspeedAlarm  `json:"overspeedAlarm,omitempty"`
+	AreaRouteAlarm      *MsgBody_0200_AreaRouteAlarm  `json:"areaRouteAlarm,omitempty"`
+	RouteTravelTime     *MsgBody_0200_RouteTravelTime `json:"routeTravelTime,omitempty"`
+	VehicleSignalStatus *uint32                       `json:"vehicleSignalStatus,omitempty"` // 0x25
+	IOStatus            *uint16                       `json:"ioStatus,omitempty"`            // 0x2A
+	Analog              *MsgBody_0200_Analog          `json:"analog,omitempty"`
+	SignalStrength      *uint8                        `json:"signalStrength,omitempty"` // 0x30
+	SatelliteCount      *uint8                        `json:"satelliteCount,omitempty"` // 0x31
+	SafetyAlarms        []*MsgBody_0200_SafetyAlarm   `json:"safetyAlarms,omitempty"`   // 0x64-0x67
+}
+
+// MsgBody_0200_OverspeedAlarm is ext info 0x11, AreaID is absent if
+// LocationType is 0.
+type MsgBody_0200_OverspeedAlarm struct {
+	LocationType uint8  `json:"locationType"`
+	AreaID       uint32 `json:"areaId"`
+}
+
+// MsgBody_0200_AreaRouteAlarm is ext info 0x12, Direction is 0 for in and 1
+// for out.
+type MsgBody_0200_AreaRouteAlarm struct {
+	LocationType uint8  `json:"locationType"`
+	AreaID       uint32 `json:"areaId"`
+	Direction    uint8  `json:"direction"`
+}
+
+// MsgBody_0200_RouteTravelTime is ext info 0x13, Result is 0 for too short
+// and 1 for too long.
+type MsgBody_0200_RouteTravelTime struct {
+	RouteID    uint32 `json:"routeId"`
+	TravelTime uint16 `json:"travelTime"` // seconds
+	Result     uint8  `json:"result"`
+}
+
+// MsgBody_0200_Analog is ext info 0x2B.
+type MsgBody_0200_Analog struct {
+	AD0 uint16 `json:"ad0"`
+	AD1 uint16 `json:"ad1"`
+}
+
+func (p *MsgBody_0200_ParsedExtInfo) parse(id uint8, data []byte, loc *time.Location) error {
+	expectLen := func(n ...int) error {
+		for _, it := range n {
+			if len(data) == it {
+				return nil
+			}
+		}
+		return fmt.Errorf("bad length %d", len(data))
+	}
+	be := binary.BigEndian
+	switch id {
+	case 0x01:
+		if err := expectLen(4); err != nil {
+			return err
+		}
+		p.Mileage = float64(be.Uint32(data)) / 10
+	case 0x02:
+		if err := expectLen(2); err != nil {
+			return err
+		}
+		v := float64(be.Uint16(data)) / 10
+		p.Fuel = &v
+	case 0x03:
+		if err := expectLen(2); err != nil {
+			return err
+		}
+		v := float64(be.Uint16(data)) / 10
+		p.RecorderSpeed = &v
+	case 0x04:
+		if err := expectLen(2); err != nil {
+			return err
+		}
+		v := be.Uint16(data)
+		p.ManualAlarmEventID = &v
+	case 0x11:
+		if err := expectLen(1, 5); err != nil {
+			return err
+		}
+		v := &MsgBody_0200_OverspeedAlarm{LocationType: data[0]}
+		if len(data) == 5 {
+			v.AreaID = be.Uint32(data[1:])
+		}
+		p.OverspeedAlarm = v
+	case 0x12:
+		if err := expectLen(6); err != nil {
+			return err
+		}
+		p.AreaRouteAlarm = &MsgBody_0200_AreaRouteAlarm{
+			LocationType: data[0],
+			AreaID:       be.Uint32(data[1:5]),
+			Direction:    data[5],
+		}
+	case 0x13:
+		if err := expectLen(7); err != nil {
+			return err
+		}
+		p.RouteTravelTime = &MsgBody_0200_RouteTravelTime{
+			RouteID:    be.Uint32(data[0:4]),
+			TravelTime: be.Uint16(data[4:6]),
+			Result:     data[6],
+		}
+	case 0x25:
+		if err := expectLen(4); err != nil {
+			return err
+		}
+		v := be.Uint32(data)
+		p.VehicleSignalStatus = &v
+	case 0x2A:
+		if err := expectLen(2); err != nil {
+			return err
+		}
+		v := be.Uint16(data)
+		p.IOStatus = &v
+	case 0x2B:
+		if err := expectLen(4); err != nil {
+			return err
+		}
+		v := be.Uint32(data)
+		p.Analog = &MsgBody_0200_Analog{AD0: uint16(v), AD1: uint16(v >> 16)}
+	case 0x30:
+		if err := expectLen(1); err != nil {
+			return err
+		}
+		v := data[0]
+		p.SignalStrength = &v
+	case 0x31:
+		if err := expectLen(1); err != nil {
+			return err
+		}
+		v := data[0]
+		p.SatelliteCount = &v
+	case 0x64, 0x65, 0x66, 0x67:
+		v, err := decodeSafetyAlarm(id, data, loc)
+		if err != nil {
+			return err
+		}
+		p.SafetyAlarms = append(p.SafetyAlarms, v)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package msg
+
+import (
+	"testing"
+)
+
+func TestParseExtInfo_0200(t *testing.T) {
+	body, err := DecodeBody_0200(mustDecodeHexString(
+		"00 00 00 00 00 00 00 03 01 5E 3E 99 07 16 78 66 00 00 00 00 00 00 23 08 16 14 04 11",
+		"01 04 00 BB F9 27",
+		"02 02 01 F4",
+		"03 02 00 D7",
+		"04 02 00 09",
+		"11 05 01 00 00 00 0A",
+		"12 06 02 00 00 00 0B 01",
+		"13 07 00 00 00 0C 01 2C 00",
+		"25 04 00 00 00 03",
+		"2A 02 00 05",
+		"2B 04 00 06 00 05",
+		"30 01 0E",
+		"31 01 0C",
+		"E0 04 E4 02 04 1A",
+	), BodyLocation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fuel, recorderSpeed := 50.0, 21.5
+	manualAlarmEventID, ioStatus := uint16(9), uint16(5)
+	vehicleSignalStatus := uint32(3)
+	signalStrength, satelliteCount := uint8(14), uint8(12)
+	expected := MsgBody_0200_ParsedExtInfo{
+		Mileage:             float64(0xBBF927) / 10,
+		Fuel:                &fuel,
+		RecorderSpeed:       &recorderSpeed,
+		ManualAlarmEventID:  &manualAlarmEventID,
+		OverspeedAlarm:      &MsgBody_0200_OverspeedAlarm{LocationType: 1, AreaID: 10},
+		AreaRouteAlarm:      &MsgBody_0200_AreaRouteAlarm{LocationType: 2, AreaID: 11, Direction: 1},
+		RouteTravelTime:     &MsgBody_0200_RouteTravelTime{RouteID: 12, TravelTime: 300, Result: 0},
+		VehicleSignalStatus: &vehicleSignalStatus,
+		IOStatus:            &ioStatus,
+		Analog:              &MsgBody_0200_Analog{AD0: 5, AD1: 6},
+		SignalStrength:      &signalStrength,
+		SatelliteCount:      &satelliteCount,
+	}
+	if b1, b2, eq := mustMarshalEqual(body.ParsedExtInfo, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+	if len(body.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", body.Warnings)
+	}
+}
+
+func TestParseExtInfo_0200_BadLength(t *testing.T) {
+	body, err := DecodeBody_0200(mustDecodeHexString(
+		"00 00 00 00 00 00 00 03 01 5E 3E 99 07 16 78 66 00 00 00 00 00 00 23 08 16 14 04 11",
+		"02 01 01",
+	), BodyLocation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if body.ParsedExtInfo.Fuel != nil || len(body.Warnings) != 1 {
+		t.Errorf("bad length not reported: %v", body.Warnings)
+	}
+}
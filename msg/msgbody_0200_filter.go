@@ -0,0 +1,82 @@
+package msg
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// NewBodyFilter_0200 accepts bodies which have any of the ext info ids in
+// "extIds", any of the alarm flags in "alarms", all of the status flags in
+// "status" and any of the active safety alarms in "safetyAlarms", empty params
+// are ignored. Active safety alarms are given as kind[:alarmType], e.g.
+// "adas:1,dsm".
+func NewBodyFilter_0200(query url.Values) BodyFilterFunc {
+	filters := make([]func(*MsgBody_0200) bool, 0)
+	if qs := splitParam(query.Get("extIds")); len(qs) > 0 {
+		extIds := make([]uint8, 0, len(qs))
+		for _, q := range qs {
+			if extId, err := strconv.Atoi(q); err == nil {
+				extIds = append(extIds, uint8(extId))
+			}
+		}
+		filters = append(filters, func(body *MsgBody_0200) bool {
+			for _, extId := range extIds {
+				for _, extInfo := range body.ExtInfo {
+					if extId == extInfo.ID {
+						return true
+					}
+				}
+			}
+			return false
+		})
+	}
+	if alarms := splitParam(query.Get("alarms")); len(alarms) > 0 {
+		filters = append(filters, func(body *MsgBody_0200) bool {
+			for _, alarm := range alarms {
+				if containsString(body.AlarmFlags, alarm) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if status := splitParam(query.Get("status")); len(status) > 0 {
+		filters = append(filters, func(body *MsgBody_0200) bool {
+			for _, st := range status {
+				if !containsString(body.StatusFlags, st) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	if safetyAlarms := splitParam(query.Get("safetyAlarms")); len(safetyAlarms) > 0 {
+		filters = append(filters, func(body *MsgBody_0200) bool {
+			for _, it := range safetyAlarms {
+				kind, alarmType, hasType := strings.Cut(it, ":")
+				for _, alarm := range body.ParsedExtInfo.SafetyAlarms {
+					if alarm.Kind == kind && (!hasType || alarmType == strconv.Itoa(int(alarm.AlarmType))) {
+						return true
+					}
+				}
+			}
+			return false
+		})
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+	return func(body any) bool {
+		body0200, ok := body.(*MsgBody_0200)
+		if !ok {
+			return true
+		}
+		for _, filter := range filters {
+			if !filter(body0200) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,89 @@
+package msg
+
+// alarmNames_0200 names the alarm bits of a 0200 body, unnamed bits are
+// reserved.
+var alarmNames_0200 = [32]string{
+	0:  "emergency",
+	1:  "overspeed",
+	2:  "fatigueDriving",
+	3:  "danger",
+	4:  "gnssModuleFault",
+	5:  "gnssAntennaOpen",
+	6:  "gnssAntennaShort",
+	7:  "powerUndervoltage",
+	8:  "powerDown",
+	9:  "displayFault",
+	10: "ttsFault",
+	11: "cameraFault",
+	12: "icCardFault",
+	13: "overspeedWarning",
+	14: "fatigueDrivingWarning",
+	18: "drivingTimeout",
+	19: "parkingTimeout",
+	20: "areaInOut",
+	21: "routeInOut",
+	22: "routeTravelTime",
+	23: "routeDeviation",
+	24: "vssFault",
+	25: "fuelAbnormal",
+	26: "vehicleStolen",
+	27: "illegalIgnition",
+	28: "illegalDisplacement",
+	29: "collision",
+	30: "rollover",
+	31: "illegalDoorOpen",
+}
+
+// statusNames_0200 names the status bits of a 0200 body, the load state in
+// bits 8-9 is a two bits field and named by loadStateNames_0200 instead.
+var statusNames_0200 = [32]string{
+	0:  "acc",
+	1:  "positioned",
+	2:  "southLatitude",
+	3:  "westLongitude",
+	4:  "outOfService",
+	5:  "coordinatesEncrypted",
+	10: "oilCircuitCut",
+	11: "electricCircuitCut",
+	12: "doorLocked",
+	13: "door1Open",
+	14: "door2Open",
+	15: "door3Open",
+	16: "door4Open",
+	17: "door5Open",
+	18: "gps",
+	19: "beidou",
+	20: "glonass",
+	21: "galileo",
+}
+
+var loadStateNames_0200 = [4]string{
+	0: "", // empty
+	1: "loadHalf",
+	2: "loadReserved",
+	3: "loadFull",
+}
+
+func setBitNames(v uint32, names *[32]string) []string {
+	flags := make([]string, 0)
+	for i, name := range names {
+		if name != "" && v&(1<<i) != 0 {
+			flags = append(flags, name)
+		}
+	}
+	return flags
+}
+
+// AlarmFlags_0200 returns the names of the alarm bits set.
+func AlarmFlags_0200(alarm uint32) []string {
+	return setBitNames(alarm, &alarmNames_0200)
+}
+
+// StatusFlags_0200 returns the names of the status bits set.
+func StatusFlags_0200(status uint32) []string {
+	flags := setBitNames(status, &statusNames_0200)
+	if name := loadStateNames_0200[(status>>8)&0x03]; name != "" {
+		flags = append(flags, name)
+	}
+	return flags
+}
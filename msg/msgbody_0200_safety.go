@@ -0,0 +1,155 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Kinds of the active safety alarms reported as 0200 ext info 0x64-0x67 by
+// Su-Biao terminals.
+const (
+	SafetyAlarmKind_ADAS = "adas"
+	SafetyAlarmKind_DSM  = "dsm"
+	SafetyAlarmKind_TPMS = "tpms"
+	SafetyAlarmKind_BSD  = "bsd"
+)
+
+var safetyAlarmKinds = map[uint8]string{
+	0x64: SafetyAlarmKind_ADAS,
+	0x65: SafetyAlarmKind_DSM,
+	0x66: SafetyAlarmKind_TPMS,
+	0x67: SafetyAlarmKind_BSD,
+}
+
+// MsgBody_0200_SafetyAlarm is an active safety alarm, fields not carried by
+// its kind are left zero. FlagStatus is 0 for none, 1 for start and 2 for end.
+type MsgBody_0200_SafetyAlarm struct {
+	Kind          string                    `json:"kind"`
+	AlarmID       uint32                    `json:"alarmId"`
+	FlagStatus    uint8                     `json:"flagStatus"`
+	AlarmType     uint8                     `json:"alarmType"`
+	Level         uint8                     `json:"level"`
+	FrontSpeed    uint8                     `json:"frontSpeed,omitempty"`    // ADAS
+	FrontDistance uint8                     `json:"frontDistance,omitempty"` // ADAS
+	DeviationType uint8                     `json:"deviationType,omitempty"` // ADAS
+	RoadSignType  uint8                     `json:"roadSignType,omitempty"`  // ADAS
+	RoadSignData  uint8                     `json:"roadSignData,omitempty"`  // ADAS
+	FatigueLevel  uint8                     `json:"fatigueLevel,omitempty"`  // DSM
+	Speed         uint8                     `json:"speed"`
+	Altitude      uint16                    `json:"altitude"`
+	Latitude      float64                   `json:"latitude"`
+	Longitude     float64                   `json:"longitude"`
+	Time          time.Time                 `json:"time"`
+	VehicleStatus uint16                    `json:"vehicleStatus"`
+	Ident         MsgBody_0200_AlarmIdent   `json:"ident"`
+	TireEvents    []*MsgBody_0200_TireEvent `json:"tireEvents,omitempty"` // TPMS
+}
+
+// MsgBody_0200_AlarmIdent identifies the attachments uploaded for an alarm.
+type MsgBody_0200_AlarmIdent struct {
+	TerminalID  string    `json:"terminalId"`
+	Time        time.Time `json:"time"`
+	SN          uint8     `json:"sn"`
+	AttachCount uint8     `json:"attachCount"`
+}
+
+type MsgBody_0200_TireEvent struct {
+	Position    uint8  `json:"position"`
+	AlarmType   uint16 `json:"alarmType"`
+	Pressure    uint16 `json:"pressure"`    // kPa
+	Temperature uint16 `json:"temperature"` // ℃
+	Battery     uint16 `json:"battery"`     // %
+}
+
+func decodeSafetyAlarm(id uint8, data []byte, loc *time.Location) (*MsgBody_0200_SafetyAlarm, error) {
+	a := &MsgBody_0200_SafetyAlarm{Kind: safetyAlarmKinds[id]}
+	buf := bytes.NewReader(data)
+	read := func(fields ...any) error {
+		for _, field := range fields {
+			if err := binary.Read(buf, binary.BigEndian, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := read(&a.AlarmID, &a.FlagStatus); err != nil {
+		return nil, err
+	}
+	switch id {
+	case 0x64:
+		if err := read(&a.AlarmType, &a.Level, &a.FrontSpeed, &a.FrontDistance, &a.DeviationType, &a.RoadSignType, &a.RoadSignData); err != nil {
+			return nil, err
+		}
+	case 0x65:
+		var reserved [4]byte
+		if err := read(&a.AlarmType, &a.Level, &a.FatigueLevel, &reserved); err != nil {
+			return nil, err
+		}
+	case 0x67:
+		if err := read(&a.AlarmType); err != nil {
+			return nil, err
+		}
+	}
+	var common struct {
+		Speed         uint8
+		Altitude      uint16
+		Latitude      uint32
+		Longitude     uint32
+		Time          [6]byte
+		VehicleStatus uint16
+		TerminalID    [7]byte
+		IdentTime     [6]byte
+		IdentSN       uint8
+		AttachCount   uint8
+		Reserved      uint8
+	}
+	if err := read(&common); err != nil {
+		return nil, err
+	}
+	var err error
+	if a.Time, err = parseSafetyAlarmTime(common.Time, loc); err != nil {
+		return nil, err
+	}
+	a.Speed = common.Speed
+	a.Altitude = common.Altitude
+	a.Latitude = float64(common.Latitude) / 1000000
+	a.Longitude = float64(common.Longitude) / 1000000
+	a.VehicleStatus = common.VehicleStatus
+	if a.Ident.TerminalID, err = decodeString(common.TerminalID[:]); err != nil {
+		return nil, err
+	}
+	if a.Ident.Time, err = parseSafetyAlarmTime(common.IdentTime, loc); err != nil {
+		return nil, err
+	}
+	a.Ident.SN = common.IdentSN
+	a.Ident.AttachCount = common.AttachCount
+	if id == 0x66 {
+		var count uint8
+		if err := read(&count); err != nil {
+			return nil, err
+		}
+		a.TireEvents = make([]*MsgBody_0200_TireEvent, count)
+		for i := range a.TireEvents {
+			a.TireEvents[i] = &MsgBody_0200_TireEvent{}
+			if err := read(a.TireEvents[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if buf.Len() != 0 {
+		return nil, fmt.Errorf("bad tailing bytes")
+	}
+	return a, nil
+}
+
+func parseSafetyAlarmTime(b [6]byte, loc *time.Location) (time.Time, error) {
+	bcdTime := hex.EncodeToString(b[:])
+	t, err := time.ParseInLocation("20060102150405", "20"+bcdTime, loc)
+	if err != nil {
+		return t, fmt.Errorf("bad time '%s': %w", bcdTime, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,62 @@
+package msg
+
+import (
+	"testing"
+)
+
+func TestDecodeSafetyAlarm_0200(t *testing.T) {
+	body, err := DecodeBody_0200(mustDecodeHexString(
+		"00 00 00 00 00 00 00 03 01 5E 3E 99 07 16 78 66 00 00 00 00 00 00 23 08 16 14 04 11",
+		"64 2F",
+		"00 00 00 01 01 02 01 3C 0A 01 00 00 3C 00 10 01 5E 3E 99 07 16 78 66 23 08 16 14 04 11 00 03",
+		"31 32 33 34 35 36 37 23 08 16 14 04 11 05 02 00",
+		"66 32",
+		"00 00 00 02 00 3C 00 10 01 5E 3E 99 07 16 78 66 23 08 16 14 04 11 00 03",
+		"31 32 33 34 35 36 37 23 08 16 14 04 11 06 00 00",
+		"01 01 00 04 00 DC 00 28 00 50",
+	), BodyLocation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ts := mustParseInLocation("2006-01-02 15:04:05", "2023-08-16 14:04:11", BodyLocation)
+	expected := []*MsgBody_0200_SafetyAlarm{
+		{
+			Kind:          SafetyAlarmKind_ADAS,
+			AlarmID:       1,
+			FlagStatus:    1,
+			AlarmType:     2,
+			Level:         1,
+			FrontSpeed:    60,
+			FrontDistance: 10,
+			DeviationType: 1,
+			Speed:         60,
+			Altitude:      16,
+			Latitude:      float64(0x015E3E99) / 1000000,
+			Longitude:     float64(0x07167866) / 1000000,
+			Time:          ts,
+			VehicleStatus: 3,
+			Ident:         MsgBody_0200_AlarmIdent{TerminalID: "1234567", Time: ts, SN: 5, AttachCount: 2},
+		},
+		{
+			Kind:          SafetyAlarmKind_TPMS,
+			AlarmID:       2,
+			Speed:         60,
+			Altitude:      16,
+			Latitude:      float64(0x015E3E99) / 1000000,
+			Longitude:     float64(0x07167866) / 1000000,
+			Time:          ts,
+			VehicleStatus: 3,
+			Ident:         MsgBody_0200_AlarmIdent{TerminalID: "1234567", Time: ts, SN: 6},
+			TireEvents: []*MsgBody_0200_TireEvent{
+				{Position: 1, AlarmType: 4, Pressure: 220, Temperature: 40, Battery: 80},
+			},
+		},
+	}
+	if b1, b2, eq := mustMarshalEqual(body.ParsedExtInfo.SafetyAlarms, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+	if len(body.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", body.Warnings)
+	}
+}
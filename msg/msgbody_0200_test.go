@@ -15,27 +15,31 @@ func TestDecodeBody_0200(t *testing.T) {
 		"23 45",
 		"34 56",
 		"23 04 25 11 01 39",
-		"01 02 FF FF",
-		"E0",
+		"01 04 00 00 FF FF",
 		"E1 03 FF FF FF",
-	))
+	), BodyLocation)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 	expected := MsgBody_0200{
-		Alarm:     0x12345678,
-		Status:    0x23456789,
-		Latitude:  float64(0x34567890) / 1000000,
-		Longitude: float64(0x56789012) / 1000000,
-		Altitude:  0x1234,
-		Speed:     float64(0x2345) / 10,
-		Direction: 0x3456,
-		Time:      mustParseInLocation("2006-01-02 15:04:05", "2023-04-25 11:01:39", time.Local),
+		Alarm:       0x12345678,
+		AlarmFlags:  AlarmFlags_0200(0x12345678),
+		Status:      0x23456789,
+		StatusFlags: StatusFlags_0200(0x23456789),
+		Latitude:    float64(0x34567890) / 1000000,
+		Longitude:   float64(0x56789012) / 1000000,
+		Altitude:    0x1234,
+		Speed:       float64(0x2345) / 10,
+		Direction:   0x3456,
+		Time:        mustParseInLocation("2006-01-02 15:04:05", "2023-04-25 11:01:39", BodyLocation),
 		ExtInfo: []*MsgBody_0200_ExtInfo{
-			{ID: 0x01, Data: mustDecodeHexString("FF FF")},
+			{ID: 0x01, Data: mustDecodeHexString("00 00 FF FF")},
 			{ID: 0xE1, Data: mustDecodeHexString("FF FF FF")},
 		},
+		ParsedExtInfo: MsgBody_0200_ParsedExtInfo{
+			Mileage: float64(0xFFFF) / 10,
+		},
 		Warnings: []string{},
 	}
 	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
@@ -51,10 +55,63 @@ func TestError(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	body, err := DecodeBody_0200(msg.Body)
+	body, err := DecodeBody_0200(msg.Body, BodyLocation)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 	t.Log(body)
 }
+
+func TestAlarmAndStatusFlags_0200(t *testing.T) {
+	alarm := AlarmFlags_0200(1<<0 | 1<<1 | 1<<15 | 1<<30)
+	if b1, b2, eq := mustMarshalEqual(alarm, []string{"emergency", "overspeed", "rollover"}); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+	status := StatusFlags_0200(1<<0 | 1<<1 | 1<<3 | 3<<8 | 1<<19)
+	if b1, b2, eq := mustMarshalEqual(status, []string{"acc", "positioned", "westLongitude", "beidou", "loadFull"}); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
+
+func TestEncodeBody_0200(t *testing.T) {
+	expected, err := DecodeBody_0200(mustDecodeHexString(
+		"00 00 00 01 00 0C 00 03 01 5E 3E 99 07 16 78 66 00 10 02 58 00 5A 23 08 16 14 04 11",
+		"01 04 00 BB F9 27",
+		"30 01 0E",
+	), BodyLocation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	raw, err := EncodeBody_0200(expected, BodyLocation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	body, err := DecodeBody_0200(raw, BodyLocation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
+
+func TestDecodeBody_0200Location(t *testing.T) {
+	raw := mustDecodeHexString("00000000 00000000 00000000 00000000 0000 0000 0000 230425110139")
+	m := &Msg{Extra: map[string]string{ExtraTZ: "UTC"}}
+	for _, loc := range []*time.Location{BodyLocation, m.Location()} {
+		body, err := DecodeBody_0200(raw, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := time.Date(2023, 4, 25, 11, 1, 39, 0, loc); !body.Time.Equal(want) {
+			t.Errorf("time %s, want %s", body.Time, want)
+		}
+	}
+	if (&Msg{}).Location() != BodyLocation {
+		t.Errorf("location of a msg without zone")
+	}
+}
@@ -0,0 +1,57 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+type MsgBody_0704 struct {
+	Count    uint16          `json:"count"`
+	Type     uint8           `json:"type"` // 0 for normal, 1 for blind area backfill
+	Items    []*MsgBody_0200 `json:"items"`
+	Warnings []string        `json:"warnings"`
+}
+
+func DecodeBody_0704(raw []byte, loc *time.Location) (*MsgBody_0704, error) {
+	var common struct {
+		Count uint16
+		Type  uint8
+	}
+	warnings := make([]string, 0)
+	buf := bytes.NewReader(raw)
+	if err := binary.Read(buf, binary.BigEndian, &common); err != nil {
+		return nil, err
+	}
+	items := make([]*MsgBody_0200, 0, common.Count)
+	for buf.Len() > 0 {
+		// a truncated batch keeps the items decoded so far
+		var length uint16
+		if err := binary.Read(buf, binary.BigEndian, &length); err != nil {
+			warnings = append(warnings, fmt.Sprintf("truncated length of item #%d in 0704 body", len(items)))
+			break
+		}
+		data := make([]byte, length)
+		if n, err := io.ReadFull(buf, data); err != nil {
+			warnings = append(warnings, fmt.Sprintf("truncated item #%d in 0704 body, %d of %d bytes", len(items), n, length))
+			break
+		}
+		item, err := DecodeBody_0200(data, loc)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("bad item #%d in 0704 body '%X': %v", len(items), data, err))
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(items) != int(common.Count) {
+		warnings = append(warnings, "count mismatch")
+	}
+	return &MsgBody_0704{
+		Count:    common.Count,
+		Type:     common.Type,
+		Items:    items,
+		Warnings: warnings,
+	}, nil
+}
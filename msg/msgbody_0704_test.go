@@ -0,0 +1,44 @@
+package msg
+
+import (
+	"testing"
+)
+
+func TestDecodeBody_0704(t *testing.T) {
+	item1 := "00 00 00 00 00 00 00 03 01 5E 3E 99 07 16 78 66 00 00 00 00 00 00 23 08 16 14 04 11"
+	item2 := "00 00 00 01 00 00 00 03 01 5E 3E 99 07 16 78 66 00 00 00 00 00 00 23 08 16 14 04 12 30 01 0E"
+	body, err := DecodeBody_0704(mustDecodeHexString(
+		"00 02",
+		"01",
+		"00 1C", item1,
+		"00 1F", item2,
+	), BodyLocation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	body1, _ := DecodeBody_0200(mustDecodeHexString(item1), BodyLocation)
+	body2, _ := DecodeBody_0200(mustDecodeHexString(item2), BodyLocation)
+	expected := MsgBody_0704{
+		Count:    2,
+		Type:     1,
+		Items:    []*MsgBody_0200{body1, body2},
+		Warnings: []string{},
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
+
+func TestDecodeBody_0704Truncated(t *testing.T) {
+	item1 := "00 00 00 00 00 00 00 03 01 5E 3E 99 07 16 78 66 00 00 00 00 00 00 23 08 16 14 04 11"
+	for _, tail := range []string{"00", "00 1F 00 00"} {
+		body, err := DecodeBody_0704(mustDecodeHexString("00 02", "01", "00 1C", item1, tail), BodyLocation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Items) != 1 || len(body.Warnings) != 2 {
+			t.Errorf("tail %s: %d items, warnings %v", tail, len(body.Items), body.Warnings)
+		}
+	}
+}
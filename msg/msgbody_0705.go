@@ -9,19 +9,19 @@ import (
 )
 
 type MsgBody_0705 struct {
-	Count    uint16
-	Time     time.Time
-	Items    []*MsgBody_0705Item
-	Warnings []string
+	Count    uint16              `json:"count"`
+	Time     time.Time           `json:"time"`
+	Items    []*MsgBody_0705Item `json:"items"`
+	Warnings []string            `json:"warnings"`
 }
 
 type MsgBody_0705Item struct {
-	ID    uint32
-	Flags uint8
-	Data  []byte
+	ID    uint32 `json:"id"`
+	Flags uint8  `json:"flags"`
+	Data  []byte `json:"data"`
 }
 
-func DecodeBody_0705(raw []byte) (*MsgBody_0705, error) {
+func DecodeBody_0705(raw []byte, loc *time.Location) (*MsgBody_0705, error) {
 	var common struct {
 		Count uint16
 		Time  [5]byte
@@ -54,7 +54,7 @@ func DecodeBody_0705(raw []byte) (*MsgBody_0705, error) {
 	}
 	bcdTime := hex.EncodeToString(common.Time[:3])
 	bcdTime += "." + hex.EncodeToString(common.Time[3:])[1:] // fix millis >= 1000
-	time, err := time.ParseInLocation("150405.000", bcdTime, time.Local)
+	time, err := time.ParseInLocation("150405.000", bcdTime, loc)
 	if err != nil {
 		warnings = append(warnings, fmt.Sprintf("bad time in 0705 body '%s': %v", bcdTime, err))
 	}
@@ -2,7 +2,6 @@ package msg
 
 import (
 	"testing"
-	"time"
 )
 
 func TestDecodeBody_0705(t *testing.T) {
@@ -11,14 +10,14 @@ func TestDecodeBody_0705(t *testing.T) {
 		"01 02 03 04 56",
 		"12 34 56 78 23 45 67 89 0A BC DE F1",
 		"23 45 67 89 12 34 56 78 90 AB CD EF",
-	))
+	), BodyLocation)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 	expected := MsgBody_0705{
 		Count: 2,
-		Time:  mustParseInLocation("15:04:05.000", "01:02:03.456", time.Local),
+		Time:  mustParseInLocation("15:04:05.000", "01:02:03.456", BodyLocation),
 		Items: []*MsgBody_0705Item{
 			{
 				ID:    0x12345678 & 0x1FFFFFFF,
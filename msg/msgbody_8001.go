@@ -0,0 +1,61 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type MsgBody_8001 struct {
+	ReplySN    uint16   `json:"replySn"`
+	ReplyID    uint16   `json:"replyId"`
+	Result     uint8    `json:"result"`
+	ResultText string   `json:"resultText"`
+	Warnings   []string `json:"warnings"`
+}
+
+var resultTexts_8001 = map[uint8]string{
+	0: "success",
+	1: "failure",
+	2: "bad message",
+	3: "unsupported",
+	4: "alarm confirmed",
+}
+
+func DecodeBody_8001(raw []byte) (*MsgBody_8001, error) {
+	var common struct {
+		ReplySN uint16
+		ReplyID uint16
+		Result  uint8
+	}
+	warnings := make([]string, 0)
+	buf := bytes.NewReader(raw)
+	if err := binary.Read(buf, binary.BigEndian, &common); err != nil {
+		return nil, err
+	}
+	if buf.Len() != 0 {
+		warnings = append(warnings, "bad tailing bytes")
+	}
+	text, ok := resultTexts_8001[common.Result]
+	if !ok {
+		text = fmt.Sprintf("unknown (%d)", common.Result)
+		warnings = append(warnings, fmt.Sprintf("unknown result in 8001 body: %d", common.Result))
+	}
+	return &MsgBody_8001{
+		ReplySN:    common.ReplySN,
+		ReplyID:    common.ReplyID,
+		Result:     common.Result,
+		ResultText: text,
+		Warnings:   warnings,
+	}, nil
+}
+
+func EncodeBody_8001(b *MsgBody_8001) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.BigEndian, struct {
+		ReplySN uint16
+		ReplyID uint16
+		Result  uint8
+	}{b.ReplySN, b.ReplyID, b.Result})
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package msg
+
+import (
+	"testing"
+)
+
+func TestDecodeBody_8001(t *testing.T) {
+	body, err := DecodeBody_8001(mustDecodeHexString(
+		"00 2A",
+		"02 00",
+		"04",
+	))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := MsgBody_8001{
+		ReplySN:    0x002A,
+		ReplyID:    0x0200,
+		Result:     4,
+		ResultText: "alarm confirmed",
+		Warnings:   []string{},
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+	body, err = DecodeBody_8001(mustDecodeHexString("00 2A 02 00 09"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if body.ResultText != "unknown (9)" || len(body.Warnings) != 1 {
+		t.Errorf("unexpected: %+v", body)
+	}
+}
+
+func TestEncodeBody_8001(t *testing.T) {
+	expected := &MsgBody_8001{ReplySN: 0x1234, ReplyID: 0x0102, Result: 1, ResultText: "failure", Warnings: []string{}}
+	raw, err := EncodeBody_8001(expected)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	body, err := DecodeBody_8001(raw)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
@@ -0,0 +1,56 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type MsgBody_8100 struct {
+	ReplySN    uint16   `json:"replySn"`
+	Result     uint8    `json:"result"`
+	ResultText string   `json:"resultText"`
+	AuthCode   string   `json:"authCode"`
+	Warnings   []string `json:"warnings"`
+}
+
+var resultTexts_8100 = map[uint8]string{
+	0: "success",
+	1: "vehicle already registered",
+	2: "vehicle not found",
+	3: "terminal already registered",
+	4: "terminal not found",
+}
+
+func DecodeBody_8100(raw []byte) (*MsgBody_8100, error) {
+	var common struct {
+		ReplySN uint16
+		Result  uint8
+	}
+	warnings := make([]string, 0)
+	buf := bytes.NewReader(raw)
+	if err := binary.Read(buf, binary.BigEndian, &common); err != nil {
+		return nil, err
+	}
+	text, ok := resultTexts_8100[common.Result]
+	if !ok {
+		text = fmt.Sprintf("unknown (%d)", common.Result)
+		warnings = append(warnings, fmt.Sprintf("unknown result in 8100 body: %d", common.Result))
+	}
+	authData, _ := io.ReadAll(buf)
+	if common.Result != 0 && len(authData) > 0 {
+		warnings = append(warnings, "auth code present on failure")
+	}
+	authCode, err := decodeString(authData)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("bad auth code in 8100 body '%X': %v", authData, err))
+	}
+	return &MsgBody_8100{
+		ReplySN:    common.ReplySN,
+		Result:     common.Result,
+		ResultText: text,
+		AuthCode:   authCode,
+		Warnings:   warnings,
+	}, nil
+}
@@ -0,0 +1,27 @@
+package msg
+
+import (
+	"testing"
+)
+
+func TestDecodeBody_8100(t *testing.T) {
+	body, err := DecodeBody_8100(mustDecodeHexString(
+		"00 05",
+		"00",
+		"41 42 43 31 32 33",
+	))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := MsgBody_8100{
+		ReplySN:    5,
+		Result:     0,
+		ResultText: "success",
+		AuthCode:   "ABC123",
+		Warnings:   []string{},
+	}
+	if b1, b2, eq := mustMarshalEqual(body, expected); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
@@ -1,12 +1,12 @@
 package msg
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,37 +21,95 @@ type MsgDB struct {
 	db        *badger.DB
 	seq       *badger.Sequence
 	counter   uint64
-	entryChan chan *badger.Entry
 	closeChan chan struct{}
 	closeWait sync.WaitGroup
-}
+	writer    *writer
 
-type msgTags struct {
-	DS  uint8
-	TTL time.Duration
+	dedup      deduper
+	duplicates uint64
+	sims       simIndex
 }
 
-func newMsgTags() *msgTags {
-	return &msgTags{DS: 0, TTL: MaxMsgTTL}
-}
+// msgKeyLayoutVersion is stored under metaKeyLayout, version 1 (no meta key)
+// encodes timestamps in seconds and version 2 in nanoseconds.
+const msgKeyLayoutVersion = 2
 
-func parseMsgTags(tags []string, mt *msgTags) {
-	for _, tag := range tags {
-		kv := strings.SplitN(tag, "=", 2)
-		k, v := strings.ToLower(strings.Trim(kv[0], " \t")), strings.Trim(kv[1], " \t")
-		switch k {
-		case "ds":
-			v, err := strconv.ParseUint(v, 10, 0)
-			if err == nil && v < 256 {
-				mt.DS = uint8(v)
+var metaKeyLayout = []byte("MSGKEYLAYOUT")
+
+// migrateKeys rewrites the msg keys written in an older layout, so that they
+// sort along with the current ones. It is a no-op once the database is
+// migrated.
+func migrateKeys(db *badger.DB) error {
+	version := uint8(1)
+	if err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(metaKeyLayout)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			if len(val) > 0 {
+				version = val[0]
+			}
+			return nil
+		})
+	}); err != nil {
+		return err
+	}
+	if version >= msgKeyLayoutVersion {
+		return nil
+	}
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	migrated := 0
+	if err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if len(item.Key()) != msgKeySize || item.IsDeletedOrExpired() {
+				continue
+			}
+			layout, err := decodeKeyLayout(item.Key())
+			if err != nil || (layout.Flags&MsgKeyFlag_Nano) != 0 {
+				continue
+			}
+			mk, err := DecodeKey(item.Key())
+			if err != nil {
+				return err
+			}
+			key, err := mk.Encode()
+			if err != nil {
+				return err
+			}
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
 			}
-		case "ttl":
-			v, err := time.ParseDuration(v)
-			if err == nil && v <= MaxMsgTTL {
-				mt.TTL = v
+			e := badger.NewEntry(key, val)
+			e.ExpiresAt = item.ExpiresAt()
+			if err := wb.SetEntry(e); err != nil {
+				return err
 			}
+			if err := wb.Delete(item.KeyCopy(nil)); err != nil {
+				return err
+			}
+			migrated++
 		}
+		return nil
+	}); err != nil {
+		return err
 	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	if migrated > 0 {
+		log.Printf("migrated %d msg keys to layout version %d", migrated, msgKeyLayoutVersion)
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set(metaKeyLayout, []byte{msgKeyLayoutVersion})
+	})
 }
 
 func OpenDB(path string, bulkSize uint) (mdb *MsgDB, err error) {
@@ -67,6 +125,14 @@ func OpenDB(path string, bulkSize uint) (mdb *MsgDB, err error) {
 	}
 	defer callOnError(db.Close)
 
+	if err = migrateKeys(db); err != nil {
+		return nil, fmt.Errorf("migrate keys: %w", err)
+	}
+
+	if err = buildIndex(db); err != nil {
+		return nil, fmt.Errorf("build index: %w", err)
+	}
+
 	seq, err := db.GetSequence([]byte("MSGSNSEQ"), 10000)
 	if err != nil {
 		return nil, err
@@ -76,70 +142,90 @@ func OpenDB(path string, bulkSize uint) (mdb *MsgDB, err error) {
 	mdb = &MsgDB{
 		db:        db,
 		seq:       seq,
-		entryChan: make(chan *badger.Entry, bulkSize),
 		closeChan: make(chan struct{}),
 	}
+	if err = mdb.sims.load(db); err != nil {
+		return nil, fmt.Errorf("load sims: %w", err)
+	}
+	mdb.writer = newWriter(db, int(bulkSize))
 
-	go mdb.scheduleTask()
-	go mdb.statTask()
+	mdb.goTask(mdb.scheduleTask)
+	mdb.goTask(mdb.statTask)
 
 	return mdb, nil
 }
 
-func (mdb *MsgDB) scheduleTask() {
+// goTask runs fn in a goroutine which Close waits for.
+func (mdb *MsgDB) goTask(fn func()) {
 	mdb.closeWait.Add(1)
-	defer mdb.closeWait.Done()
+	go func() {
+		defer mdb.closeWait.Done()
+		fn()
+	}()
+}
+
+func (mdb *MsgDB) scheduleTask() {
 	tkGC := time.NewTicker(time.Hour)
 	defer tkGC.Stop()
-	tkFlush := time.NewTicker(time.Second)
-	defer tkFlush.Stop()
+	tkDedup := time.NewTicker(dedupRecentAge)
+	defer tkDedup.Stop()
+	tkSims := time.NewTicker(simFlushInterval)
+	defer tkSims.Stop()
 	for {
 		select {
 		case <-tkGC.C:
 			mdb.db.RunValueLogGC(0.5)
-		case <-tkFlush.C:
-			mdb.flush()
+		case <-tkDedup.C:
+			mdb.dedup.prune()
+		case <-tkSims.C:
+			if err := mdb.sims.flush(mdb.db); err != nil {
+				log.Println(fmt.Errorf("flush sims: %w", err))
+			}
 		case <-mdb.closeChan:
-			mdb.flush()
-			mdb.db.RunValueLogGC(0.5)
 			return
 		}
 	}
 }
 
-func (mdb *MsgDB) receiveTask(s server.Server) {
-	mdb.closeWait.Add(1)
-	defer mdb.closeWait.Done()
+// receiveTask handles the batches of s until the MsgDB or done is closed,
+// events of DS values not accepted by allowDS are rejected. A nil allowDS
+// accepts every DS. Batches are acknowledged once committed, so the client
+// resends the batches lost by a failed commit or a crash.
+func (mdb *MsgDB) receiveTask(s server.Server, allowDS func(uint8) bool, done <-chan struct{}) {
 	defer s.Close()
 	recvChan := s.ReceiveChan()
 	for {
 		select {
 		case batch := <-recvChan:
+			if batch == nil {
+				return
+			}
+			b := mdb.NewBatch()
+			b.AllowDS = allowDS
 			for _, event := range batch.Events {
 				data, ok := event.(map[string]any)
 				if !ok {
 					continue
 				}
 
-				msgField, ok := data["message"].(string)
+				msg, tags, ok := parseEvent(data)
 				if !ok {
 					continue
 				}
-				msg := strings.Trim(msgField, "\x00\r\n\t ")
-
-				tags := newMsgTags()
-				tagsField, ok := data["tags"].([]string)
-				if ok {
-					parseMsgTags(tagsField, tags)
-				}
 
-				if err := mdb.handleEventMsg(msg, tags); err != nil {
+				if err := b.handleEventMsg(msg, tags); err != nil {
 					b, _ := json.Marshal(msg)
 					log.Println(fmt.Errorf("handleLogEvent: %w: %s", err, string(b)))
 				}
 				atomic.AddUint64(&mdb.counter, 1)
 			}
+			if err := b.Commit(); err != nil {
+				log.Println(fmt.Errorf("receiveTask commit: %w", err))
+				continue
+			}
 			batch.ACK()
+		case <-done:
+			return
 		case <-mdb.closeChan:
 			return
 		}
@@ -148,59 +234,183 @@ func (mdb *MsgDB) receiveTask(s server.Server) {
 
 func (mdb *MsgDB) statTask() {
 	interval := 10
-	mdb.closeWait.Add(1)
-	defer mdb.closeWait.Done()
 	tk := time.NewTicker(time.Duration(interval * int(time.Second)))
 	defer tk.Stop()
 	for {
 		select {
 		case <-tk.C:
-			log.Printf("messages rate: %.2f/s", float64(atomic.SwapUint64(&mdb.counter, 0))/float64(interval))
+			ws := mdb.WriteStats()
+			log.Printf("messages rate: %.2f/s, write queue: %d/%d, pending: %d", float64(atomic.SwapUint64(&mdb.counter, 0))/float64(interval), ws.QueueDepth, ws.QueueSize, ws.Pending)
 		case <-mdb.closeChan:
 			return
 		}
 	}
 }
 
+// handleEventMsg parses and writes a log line without waiting for the commit.
 func (mdb *MsgDB) handleEventMsg(msg string, tags *msgTags) error {
-	sn, err := mdb.seq.Next()
+	b := mdb.NewBatch()
+	err := b.handleEventMsg(msg, tags)
+	b.commitAsync()
+	return err
+}
+
+func (b *Batch) handleEventMsg(msg string, tags *msgTags) error {
+	sn, err := b.mdb.seq.Next()
 	if err != nil {
 		return err
 	}
-	m, mk, err := ParseLog(msg, tags.DS, uint32(sn))
+	r := newEventReject(msg, tags)
+	if b.AllowDS != nil && !b.AllowDS(tags.DS) {
+		return b.reject(uint32(sn), r, RejectForbiddenDS, fmt.Errorf("%w: %d", ErrForbiddenDS, tags.DS))
+	}
+	lf, err := LookupLogFormat(tags.Format)
+	if err != nil {
+		return b.reject(uint32(sn), r, RejectUnknownFormat, err)
+	}
+	m, mk, err := lf.ParseInLocation(msg, tags.location(), tags.DS, uint32(sn))
 	if err != nil {
 		if err == ErrEmptyMsg {
 			return nil // for empty msg (just two 0x7E), ignore
 		}
+		return b.reject(uint32(sn), r, parseRejectReason(err), err)
+	}
+	tags.setExtra(m)
+	if err := b.put(mk, m, tags.TTL); err != nil {
+		if errors.Is(err, ErrBadSimNo) {
+			return b.reject(uint32(sn), r, RejectSimNo, err)
+		}
 		return err
 	}
-	key, err := mk.Encode()
+	return nil
+}
+
+// Record is a msg frame captured from a source other than a codec log.
+type Record struct {
+	Raw       []byte
+	TX        bool
+	Timestamp time.Time
+	DS        uint8
+	TTL       time.Duration
+	Extra     map[string]string
+}
+
+// Store decodes and writes a captured msg frame without waiting for the
+// commit, empty frames are ignored.
+func (mdb *MsgDB) Store(r *Record) error {
+	b := mdb.NewBatch()
+	err := b.Store(r)
+	b.commitAsync()
+	return err
+}
+
+// Store decodes and adds a captured msg frame, empty frames are ignored.
+func (b *Batch) Store(r *Record) error {
+	atomic.AddUint64(&b.mdb.counter, 1)
+	sn, err := b.mdb.seq.Next()
+	if err != nil {
+		return err
+	}
+	rj := &Reject{Line: hex.EncodeToString(r.Raw), DS: r.DS, Extra: r.Extra}
+	m, err := Decode(r.Raw)
 	if err != nil {
+		if err == ErrEmptyMsg {
+			return nil
+		}
+		return b.reject(uint32(sn), rj, RejectBadMsg, err)
+	}
+	if len(r.Extra) > 0 {
+		m.Extra = r.Extra
+	}
+	ttl := r.TTL
+	if ttl <= 0 || ttl > MaxMsgTTL {
+		ttl = MaxMsgTTL
+	}
+	if err := b.put(newMsgKey(m, r.Timestamp, r.TX, r.DS, uint32(sn)), m, ttl); err != nil {
+		if errors.Is(err, ErrBadSimNo) {
+			return b.reject(uint32(sn), rj, RejectSimNo, err)
+		}
 		return err
 	}
-	if len(mdb.entryChan) == cap(mdb.entryChan) {
-		mdb.flush()
+	return nil
+}
+
+// LogSource describes how lines of a codec log read outside of Filebeat are
+// stored, zero values select the same defaults as missing Filebeat tags.
+type LogSource struct {
+	DS       uint8
+	TTL      time.Duration
+	Format   string
+	Location *time.Location
+	Host     string
+	File     string
+}
+
+func (src *LogSource) tags() *msgTags {
+	tags := newMsgTags()
+	tags.DS, tags.Host, tags.File = src.DS, src.Host, src.File
+	if src.TTL > 0 && src.TTL <= MaxMsgTTL {
+		tags.TTL = src.TTL
+	}
+	if src.Format != "" {
+		tags.Format = src.Format
+	}
+	if src.Location != nil {
+		tags.Location = src.Location
+	}
+	return tags
+}
+
+// StoreLog parses and writes a codec log line without waiting for the
+// commit, empty msgs are ignored.
+func (mdb *MsgDB) StoreLog(line string, src *LogSource) error {
+	b := mdb.NewBatch()
+	err := b.StoreLog(line, src)
+	b.commitAsync()
+	return err
+}
+
+// StoreLog parses and adds a codec log line, empty msgs are ignored.
+func (b *Batch) StoreLog(line string, src *LogSource) error {
+	atomic.AddUint64(&b.mdb.counter, 1)
+	return b.handleEventMsg(line, src.tags())
+}
+
+// StoreEvent parses and writes a Filebeat event without waiting for the
+// commit, see Batch.StoreEvent.
+func (mdb *MsgDB) StoreEvent(data map[string]any, src *LogSource) error {
+	b := mdb.NewBatch()
+	err := b.StoreEvent(data, src)
+	b.commitAsync()
+	return err
+}
+
+// StoreEvent parses and adds a Filebeat event, the tags and fields of the
+// event take precedence over src. It returns ErrNoMessage for events without
+// a message.
+func (b *Batch) StoreEvent(data map[string]any, src *LogSource) error {
+	msg, tags, ok := parseEventTags(data, src.tags())
+	if !ok {
+		return ErrNoMessage
+	}
+	atomic.AddUint64(&b.mdb.counter, 1)
+	return b.handleEventMsg(msg, tags)
+}
+
+// put adds a msg, msgs already stored within DedupWindow are dropped when
+// the batch is committed.
+func (b *Batch) put(mk *MsgKey, m *Msg, ttl time.Duration) error {
+	key, err := mk.Encode()
+	if err != nil {
+		return err
 	}
-	mdb.entryChan <- badger.NewEntry(key, m.Raw).WithTTL(tags.TTL)
+	b.msgs = append(b.msgs, &batchMsg{mk: mk, m: m, key: key, ttl: ttl})
 	return nil
 }
 
+// flush waits for the msgs written so far to be committed.
 func (mdb *MsgDB) flush() {
-	if err := mdb.db.Update(func(txn *badger.Txn) error {
-		for i := 0; i < cap(mdb.entryChan); i++ {
-			select {
-			case e := <-mdb.entryChan:
-				if err := txn.SetEntry(e); err != nil {
-					log.Println(fmt.Errorf("flush setEntry: %w", err))
-				}
-			default:
-				return nil
-			}
-		}
-		return nil
-	}); err != nil {
-		log.Println(fmt.Errorf("flush update: %w", err))
-	}
+	mdb.writer.flush()
 }
 
 func (mdb *MsgDB) Listen(bind string) error {
@@ -208,20 +418,35 @@ func (mdb *MsgDB) Listen(bind string) error {
 	if err != nil {
 		return err
 	}
-	go mdb.receiveTask(s)
+	mdb.goTask(func() { mdb.receiveTask(s, nil, nil) })
 	return nil
 }
 
 func (mdb *MsgDB) Close() error {
 	close(mdb.closeChan)
 	mdb.closeWait.Wait()
+	mdb.writer.close()
+	if err := mdb.sims.close(mdb.db); err != nil {
+		log.Println(fmt.Errorf("flush sims: %w", err))
+	}
+	mdb.db.RunValueLogGC(0.5)
 	mdb.seq.Release()
 	mdb.db.Close()
 	return nil
 }
 
 type MsgItem struct {
-	item *badger.Item
+	item   *badger.Item
+	cursor []byte
+}
+
+// Cursor is the position of a msg returned by Iterate or IterateAll, to
+// resume the iteration after it.
+func (mi *MsgItem) Cursor() []byte {
+	if mi.cursor == nil {
+		return mi.item.KeyCopy(nil) // the encoded MsgKey
+	}
+	return mi.cursor
 }
 
 func (mi *MsgItem) Key() (*MsgKey, error) {
@@ -232,22 +457,67 @@ func (mi *MsgItem) Value() (*Msg, error) {
 	if err != nil {
 		return nil, err
 	}
-	return Decode(val)
+	return decodeMsgValue(val)
 }
 
 var ErrStopIteration = errors.New("stop iteration")
 
+var ErrNoMessage = errors.New("event without message")
+
 func (mdb *MsgDB) Iterate(simNo string, since time.Time, fn func(*MsgItem) error) error {
+	return mdb.IterateAfter(simNo, since, nil, fn)
+}
+
+// IterateAfter is Iterate resumed after the msg of a cursor from
+// MsgItem.Cursor, since is ignored when after is given.
+func (mdb *MsgDB) IterateAfter(simNo string, since time.Time, after []byte, fn func(*MsgItem) error) error {
 	seek, err := (&MsgKey{SimNo: simNo, Timestamp: since}).Encode()
 	if err != nil {
 		return err
 	}
 	prefix := seek[:SimNoBytes]
+	if len(after) > 0 {
+		if len(after) != msgKeySize || !bytes.HasPrefix(after, prefix) {
+			return ErrBadCursor
+		}
+		seek = after
+	}
 	return mdb.db.View(func(txn *badger.Txn) error {
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 		mi := &MsgItem{}
 		for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+			if len(after) > 0 && bytes.Equal(it.Item().Key(), after) {
+				continue
+			}
+			mi.item = it.Item()
+			if err := fn(mi); err != nil {
+				if err == ErrStopIteration {
+					break
+				}
+				log.Println(err)
+			}
+		}
+		return nil
+	})
+}
+
+// IterateUntil is Iterate stopped after the msg of a cursor from
+// MsgItem.Cursor, which it includes.
+func (mdb *MsgDB) IterateUntil(simNo string, since time.Time, until []byte, fn func(*MsgItem) error) error {
+	seek, err := (&MsgKey{SimNo: simNo, Timestamp: since}).Encode()
+	if err != nil {
+		return err
+	}
+	prefix := seek[:SimNoBytes]
+	if len(until) != msgKeySize || !bytes.HasPrefix(until, prefix) {
+		return ErrBadCursor
+	}
+	return mdb.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		mi := &MsgItem{}
+		for it.Seek(seek); it.ValidForPrefix(prefix) && bytes.Compare(it.Item().Key(), until) <= 0; it.Next() {
 			mi.item = it.Item()
 			if err := fn(mi); err != nil {
 				if err == ErrStopIteration {
@@ -3,6 +3,8 @@ package msg
 import (
 	"testing"
 	"time"
+
+	"github.com/dgraph-io/badger/v4"
 )
 
 func TestParseMsgTags(t *testing.T) {
@@ -22,3 +24,194 @@ func TestParseMsgTags(t *testing.T) {
 		t.Errorf("parse failed: tags=%d, ttl=%s\n", tags.DS, tags.TTL)
 	}
 }
+
+func TestMigrateKeys(t *testing.T) {
+	dir := t.TempDir()
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Now().Add(-time.Hour).Truncate(time.Second)
+	legacy := encodeLegacyKey(&MsgKey{SimNo: "12345678901", Timestamp: ts, SN: 1, MsgID: 0x0200, PartIndex: 1, PartTotal: 1})
+	if err := db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(legacy, []byte{0x7E, 0x7E}).WithTTL(time.Hour))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	mdb, err := OpenDB(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	found := 0
+	if err := mdb.Iterate("12345678901", ts.Add(-time.Second), func(mi *MsgItem) error {
+		mk, err := mi.Key()
+		if err != nil {
+			return err
+		}
+		if !mk.Timestamp.Equal(ts) || mk.SN != 1 || mi.item.ExpiresAt() == 0 {
+			t.Errorf("bad migrated key: %+v", mk)
+		}
+		found++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if found != 1 {
+		t.Errorf("found %d msgs after migration", found)
+	}
+}
+
+func TestParseMsgTagsFormat(t *testing.T) {
+	tags := newMsgTags()
+	if tags.Format != DefaultLogFormat {
+		t.Errorf("default format: %s", tags.Format)
+	}
+	parseMsgTags([]string{"fmt=iso8601"}, tags)
+	if tags.Format != "iso8601" {
+		t.Errorf("parse failed: fmt=%s\n", tags.Format)
+	}
+}
+
+func TestStorePeerAndConn(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	tags := newMsgTags()
+	parseMsgTags([]string{"fmt=conn-peer"}, tags)
+	if err := mdb.handleEventMsg("20230425110139 c7 10.0.0.1:52011 Rx 7E000200000138001380000001A97E", tags); err != nil {
+		t.Fatal(err)
+	}
+	mdb.flush()
+	found := 0
+	if err := mdb.Iterate("13800138000", time.Time{}, func(mi *MsgItem) error {
+		m, err := mi.Value()
+		if err != nil {
+			return err
+		}
+		if m.Peer() != "10.0.0.1:52011" || m.ConnID() != "c7" {
+			t.Errorf("bad extra: %v", m.Extra)
+		}
+		found++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if found != 1 {
+		t.Errorf("found %d msgs", found)
+	}
+}
+
+func TestStoreRecord(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	ts := time.Date(2023, 4, 25, 11, 1, 39, 500, time.UTC)
+	if err := mdb.Store(&Record{
+		Raw:       mustDecodeHexString("7E000200000138001380000001A97E"),
+		TX:        true,
+		Timestamp: ts,
+		DS:        2,
+		Extra:     map[string]string{ExtraConn: "tap-1"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	mdb.flush()
+	found := 0
+	if err := mdb.Iterate("13800138000", time.Time{}, func(mi *MsgItem) error {
+		mk, err := mi.Key()
+		if err != nil {
+			return err
+		}
+		if !mk.Timestamp.Equal(ts) || !mk.TX || mk.DS != 2 {
+			t.Errorf("bad key: %+v", mk)
+		}
+		m, err := mi.Value()
+		if err != nil {
+			return err
+		}
+		if m.ConnID() != "tap-1" {
+			t.Errorf("bad extra: %v", m.Extra)
+		}
+		found++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if found != 1 {
+		t.Errorf("found %d msgs", found)
+	}
+}
+
+func TestIterateAfter(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	base := time.Date(2023, 4, 25, 10, 0, 0, 0, time.UTC)
+	m := mustDecode(t, "7E000200000138001380000001A97E")
+	b := mdb.NewBatch()
+	for i := 0; i < 5; i++ {
+		if err := b.put(newMsgKey(m, base.Add(time.Duration(i)*time.Minute), false, 0, uint32(i)), m, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	page := func(after []byte, limit int) (sns []uint32, cursor []byte) {
+		t.Helper()
+		if err := mdb.IterateAfter("13800138000", base, after, func(mi *MsgItem) error {
+			if len(sns) == limit {
+				return ErrStopIteration
+			}
+			mk, err := mi.Key()
+			if err != nil {
+				return err
+			}
+			sns, cursor = append(sns, mk.SN), mi.Cursor()
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return sns, cursor
+	}
+	page1, cursor := page(nil, 3)
+	page2, _ := page(cursor, 3)
+	if !equalSNs(page1, 0, 1, 2) || !equalSNs(page2, 3, 4) {
+		t.Errorf("pages %v %v", page1, page2)
+	}
+	other, err := (&MsgKey{SimNo: "13800138001", Timestamp: base}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, after := range [][]byte{{1}, other} {
+		if err := mdb.IterateAfter("13800138000", base, after, nil); err != ErrBadCursor {
+			t.Errorf("cursor %x err %v", after, err)
+		}
+		if err := mdb.IterateUntil("13800138000", base, after, nil); err != ErrBadCursor {
+			t.Errorf("cursor %x err %v", after, err)
+		}
+	}
+	var before []uint32
+	if err := mdb.IterateUntil("13800138000", base.Add(time.Minute), cursor, func(mi *MsgItem) error {
+		mk, err := mi.Key()
+		if err != nil {
+			return err
+		}
+		before = append(before, mk.SN)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !equalSNs(before, 1, 2) {
+		t.Errorf("until cursor %v", before)
+	}
+}
@@ -0,0 +1,224 @@
+package msg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// DedupWindow is how long a stored msg is remembered to drop the same msg
+// shipped again, zero disables deduplication.
+var DedupWindow = 24 * time.Hour
+
+// dedupKeyPrefix starts the keys marking stored msgs, followed by the
+// dedupHash. The keys are shorter than msg keys.
+var dedupKeyPrefix = []byte("DEDUP")
+
+// dedupHash identifies a msg regardless of the SN it was stored with.
+type dedupHash [16]byte
+
+// newDedupHash hashes the SimNo, timestamp, direction and raw bytes of a msg
+// along with its source, which is the DS and the extra fields such as the
+// host and file of the log line.
+func newDedupHash(mk *MsgKey, m *Msg) dedupHash {
+	h := sha256.New()
+	var buf [8]byte
+	h.Write([]byte(mk.SimNo))
+	binary.BigEndian.PutUint64(buf[:], uint64(mk.Timestamp.UnixNano()))
+	h.Write(buf[:])
+	flags := []byte{mk.DS, 0}
+	if mk.TX {
+		flags[1] = 1
+	}
+	h.Write(flags)
+	binary.BigEndian.PutUint64(buf[:], uint64(len(m.Raw)))
+	h.Write(buf[:])
+	h.Write(m.Raw)
+	keys := make([]string, 0, len(m.Extra))
+	for k := range m.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%q=%q;", k, m.Extra[k])
+	}
+	var dh dedupHash
+	copy(dh[:], h.Sum(nil))
+	return dh
+}
+
+func encodeDedupKey(dh dedupHash) []byte {
+	return append(append(make([]byte, 0, len(dedupKeyPrefix)+len(dh)), dedupKeyPrefix...), dh[:]...)
+}
+
+// dedupRecentAge is how long the hashes of committed msgs are kept in
+// memory, past it their markers are expected to be in the DB.
+const dedupRecentAge = time.Minute
+
+// deduper remembers the msgs of the batches being committed, with a zero
+// time, and of the batches committed lately, whose markers may not be found
+// in the DB yet.
+type deduper struct {
+	lock   sync.Mutex
+	recent map[dedupHash]time.Time
+}
+
+// dedup drops the msgs of b stored within the window, or held by another
+// batch being committed, and holds the others until b is committed. The DB
+// is looked up for the whole batch at once, outside the lock.
+func (b *Batch) dedup() error {
+	d := &b.mdb.dedup
+	for _, bm := range b.msgs {
+		bm.dh = newDedupHash(bm.mk, bm.m)
+	}
+	var dups uint64
+	defer func() { atomic.AddUint64(&b.mdb.duplicates, dups) }()
+	msgs := make([]*batchMsg, 0, len(b.msgs))
+	inBatch := make(map[dedupHash]bool, len(b.msgs))
+	d.lock.Lock()
+	for _, bm := range b.msgs {
+		if _, ok := d.recent[bm.dh]; ok || inBatch[bm.dh] {
+			dups++
+			continue
+		}
+		inBatch[bm.dh] = true
+		msgs = append(msgs, bm)
+	}
+	d.lock.Unlock()
+	if len(msgs) > 0 {
+		if err := b.mdb.db.View(func(txn *badger.Txn) error {
+			kept := msgs[:0]
+			for _, bm := range msgs {
+				_, err := txn.Get(encodeDedupKey(bm.dh))
+				if err == nil {
+					dups++
+					continue
+				} else if err != badger.ErrKeyNotFound {
+					return err
+				}
+				kept = append(kept, bm)
+			}
+			msgs = kept
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.recent == nil {
+		d.recent = make(map[dedupHash]time.Time)
+	}
+	b.msgs = msgs[:0]
+	for _, bm := range msgs {
+		if _, ok := d.recent[bm.dh]; ok {
+			dups++ // held by a batch meanwhile
+			continue
+		}
+		d.recent[bm.dh] = time.Time{}
+		b.msgs = append(b.msgs, bm)
+	}
+	return nil
+}
+
+// release keeps the msgs held by a batch as recent once committed, or
+// forgets them if the commit failed so that they are stored when sent again.
+func (d *deduper) release(msgs []*batchMsg, err error) {
+	now := time.Now()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, bm := range msgs {
+		if err != nil {
+			delete(d.recent, bm.dh)
+		} else {
+			d.recent[bm.dh] = now
+		}
+	}
+}
+
+func (d *deduper) prune() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for dh, t := range d.recent {
+		if !t.IsZero() && time.Since(t) > dedupRecentAge {
+			delete(d.recent, dh)
+		}
+	}
+}
+
+type DedupeStats struct {
+	Scanned int
+	Removed int
+}
+
+// Dedupe removes the msgs stored more than once, keeping the first of each,
+// regardless of DedupWindow, and rebuilds the SimInfo entries. The duplicates
+// are only counted if dryRun.
+func (mdb *MsgDB) Dedupe(dryRun bool) (*DedupeStats, error) {
+	stats := &DedupeStats{}
+	wb := mdb.db.NewWriteBatch()
+	defer wb.Cancel()
+	if err := mdb.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		// duplicates share the SimNo and timestamp, which lead the keys
+		groupSize := SimNoBytes + 8
+		var group []byte
+		seen := make(map[dedupHash]bool)
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if len(item.Key()) != msgKeySize || item.IsDeletedOrExpired() {
+				continue
+			}
+			mk, err := DecodeKey(item.Key())
+			if err != nil {
+				continue
+			}
+			stats.Scanned++
+			if !bytes.Equal(group, item.Key()[:groupSize]) {
+				group = item.KeyCopy(nil)[:groupSize]
+				seen = make(map[dedupHash]bool)
+			}
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			m, err := decodeMsgValue(val)
+			if err != nil {
+				continue
+			}
+			dh := newDedupHash(mk, m)
+			if !seen[dh] {
+				seen[dh] = true
+				continue
+			}
+			stats.Removed++
+			if !dryRun {
+				key := item.KeyCopy(nil)
+				keys, _ := indexKeys(key, m)
+				for _, k := range append(keys, key) {
+					if err := wb.Delete(k); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return stats, nil
+	}
+	if err := wb.Flush(); err != nil {
+		return nil, err
+	}
+	return stats, mdb.sims.rebuild(mdb.db)
+}
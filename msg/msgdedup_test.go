@@ -0,0 +1,127 @@
+package msg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestDedup(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	line := "20230425110139 Rx 7e000200000138001380000001a97e"
+	src := &LogSource{Host: "gw1", File: "codec.log"}
+	for _, s := range []*LogSource{src, src, {Host: "gw2", File: "codec.log"}, {Host: "gw1", File: "codec.log", DS: 1}} {
+		if err := mdb.StoreLog(line, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// re-shipped after the first ones were committed
+	mdb.flush()
+	mdb.dedup.prune()
+	mdb.dedup.recent = nil
+	if err := mdb.StoreLog(line, src); err != nil {
+		t.Fatal(err)
+	}
+	mdb.flush()
+	if n := countMsgs(t, mdb, "13800138000"); n != 3 {
+		t.Errorf("stored %d msgs, want 3", n)
+	}
+	if ws := mdb.WriteStats(); ws.Duplicates != 2 {
+		t.Errorf("%d duplicates, want 2", ws.Duplicates)
+	}
+}
+
+func TestDedupCommitError(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	lines := []string{
+		"20230425110139 Rx 7e000200000138001380000001a97e",
+		"20230425110140 Rx 7e000200000138001380000001a97e",
+	}
+	b := mdb.NewBatch()
+	for _, line := range lines {
+		if err := b.StoreLog(line, &LogSource{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// badger refuses keys this large, failing the whole batch
+	b.entries = append(b.entries, badger.NewEntry(make([]byte, 1<<16), nil))
+	if err := b.Commit(); err == nil {
+		t.Fatal("commit succeeded")
+	}
+	// resent by the shipper as the batch was not acked
+	b = mdb.NewBatch()
+	for _, line := range lines {
+		if err := b.StoreLog(line, &LogSource{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countMsgs(t, mdb, "13800138000"); n != 2 {
+		t.Errorf("stored %d msgs, want 2", n)
+	}
+	if ws := mdb.WriteStats(); ws.Duplicates != 0 {
+		t.Errorf("%d duplicates, want 0", ws.Duplicates)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	window := DedupWindow
+	DedupWindow = 0
+	defer func() { DedupWindow = window }()
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	for _, line := range []string{
+		"20230425110139 Rx 7e000200000138001380000001a97e",
+		"20230425110139 Rx 7e000200000138001380000001a97e",
+		"20230425110139 Tx 7e000200000138001380000001a97e",
+		"20230425110140 Rx 7e000200000138001380000001a97e",
+		"20230425110139 Rx 7e000200000138001380000001a97e",
+	} {
+		mdb.StoreLog(line, &LogSource{})
+	}
+	mdb.flush()
+	stats, err := mdb.Dedupe(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Scanned != 5 || stats.Removed != 2 || countMsgs(t, mdb, "13800138000") != 5 {
+		t.Errorf("dry run %+v", stats)
+	}
+	if stats, err = mdb.Dedupe(false); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Removed != 2 {
+		t.Errorf("dedupe %+v", stats)
+	}
+	var tx []bool
+	mdb.Iterate("13800138000", time.Time{}, func(mi *MsgItem) error {
+		mk, _ := mi.Key()
+		tx = append(tx, mk.TX)
+		return nil
+	})
+	if len(tx) != 3 {
+		t.Errorf("%d msgs left, want 3", len(tx))
+	}
+	indexed := 0
+	mdb.IteratePeers("13800138000", time.Time{}, time.Now(), func(*PeerItem) error {
+		indexed++
+		return nil
+	})
+	if indexed != 3 {
+		t.Errorf("%d msgs left in the peer index, want 3", indexed)
+	}
+}
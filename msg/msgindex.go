@@ -0,0 +1,276 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// The time index orders msgs of every SimNo by timestamp, its keys are the
+// prefix, the timestamp in Unix nanoseconds and the msg key. The MsgID index
+// adds the MsgID after the prefix. Index entries expire along with their
+// msgs and have no value.
+//
+// The peer index groups the msgs of a SimNo by the remote address they were
+// logged with, its keys are the prefix, the SimNo, the length and bytes of
+// the peer address, the timestamp and the msg key. Its values are the
+// connection IDs of the msgs.
+var (
+	timeIndexPrefix  = []byte("TIDX")
+	msgIDIndexPrefix = []byte("MIDX")
+	peerIndexPrefix  = []byte("PIDX")
+)
+
+// msgIndexVersion is stored under metaKeyIndex once the index of the msgs
+// written before it was introduced is built, version 2 adds the peer index.
+const msgIndexVersion = 2
+
+// maxIndexedPeer bounds the length of the peer addresses in the peer index.
+const maxIndexedPeer = 255
+
+var metaKeyIndex = []byte("MSGINDEX")
+
+var ErrBadCursor = errors.New("bad cursor")
+
+// cursorSize is the size of a position in the indexes, the timestamp and the
+// msg key.
+var cursorSize = 8 + msgKeySize
+
+// indexKeys returns the index keys of a msg and its encoded key, along with
+// their values.
+func indexKeys(key []byte, m *Msg) (keys, values [][]byte) {
+	cursor := key[SimNoBytes : SimNoBytes+8] // the encoded timestamp
+	timeKey := make([]byte, 0, len(timeIndexPrefix)+cursorSize)
+	timeKey = append(append(append(timeKey, timeIndexPrefix...), cursor...), key...)
+	msgIDKey := make([]byte, 0, len(msgIDIndexPrefix)+2+cursorSize)
+	msgIDKey = append(append(msgIDKey, msgIDIndexPrefix...), byte(m.MsgID>>8), byte(m.MsgID))
+	msgIDKey = append(append(msgIDKey, cursor...), key...)
+	peer := m.Peer()
+	if len(peer) > maxIndexedPeer {
+		peer = peer[:maxIndexedPeer]
+	}
+	peerKey := make([]byte, 0, len(peerIndexPrefix)+SimNoBytes+1+len(peer)+cursorSize)
+	peerKey = append(append(peerKey, peerIndexPrefix...), key[:SimNoBytes]...)
+	peerKey = append(append(append(peerKey, byte(len(peer))), peer...), cursor...)
+	peerKey = append(peerKey, key...)
+	var conn []byte
+	if connID := m.ConnID(); connID != "" {
+		conn = []byte(connID)
+	}
+	return [][]byte{timeKey, msgIDKey, peerKey}, [][]byte{nil, nil, conn}
+}
+
+// unixNanos is the timestamp of t as encoded in the indexes.
+func unixNanos(t time.Time) uint64 {
+	if t.Before(time.Unix(0, 0)) {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// buildIndex indexes the msgs written before the indexes were introduced. It
+// is a no-op once built.
+func buildIndex(db *badger.DB) error {
+	built := false
+	if err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(metaKeyIndex)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			built = len(val) > 0 && val[0] >= msgIndexVersion
+			return nil
+		})
+	}); err != nil || built {
+		return err
+	}
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	indexed := 0
+	if err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if len(item.Key()) != msgKeySize || item.IsDeletedOrExpired() {
+				continue
+			}
+			layout, err := decodeKeyLayout(item.Key())
+			if err != nil || (layout.Flags&MsgKeyFlag_Nano) == 0 {
+				continue
+			}
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			m, err := decodeMsgValue(val)
+			if err != nil {
+				m = &Msg{}
+			}
+			m.MsgID = layout.MsgID
+			keys, values := indexKeys(item.KeyCopy(nil), m)
+			for i, key := range keys {
+				e := badger.NewEntry(key, values[i])
+				e.ExpiresAt = item.ExpiresAt()
+				if err := wb.SetEntry(e); err != nil {
+					return err
+				}
+			}
+			indexed++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	if indexed > 0 {
+		log.Printf("indexed %d msgs", indexed)
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set(metaKeyIndex, []byte{msgIndexVersion})
+	})
+}
+
+// ScanFilter narrows IterateAll, zero fields select every msg.
+type ScanFilter struct {
+	// MsgIDs selects msgs by MsgID, the MsgID index is used for a single one.
+	MsgIDs []uint16
+	// Key selects msgs by key before their value is read.
+	Key func(*MsgKey) bool
+	// After resumes a scan after the msg of the cursor, see MsgItem.Cursor.
+	After []byte
+}
+
+// IterateAll calls fn with the msgs of every SimNo between since and until,
+// in timestamp order.
+func (mdb *MsgDB) IterateAll(since, until time.Time, filter *ScanFilter, fn func(*MsgItem) error) error {
+	if filter == nil {
+		filter = &ScanFilter{}
+	}
+	if len(filter.After) != 0 && len(filter.After) != cursorSize {
+		return ErrBadCursor
+	}
+	prefix := timeIndexPrefix
+	var msgIDs map[uint16]bool
+	if len(filter.MsgIDs) == 1 {
+		prefix = append(append([]byte(nil), msgIDIndexPrefix...), byte(filter.MsgIDs[0]>>8), byte(filter.MsgIDs[0]))
+	} else if len(filter.MsgIDs) > 1 {
+		msgIDs = make(map[uint16]bool)
+		for _, id := range filter.MsgIDs {
+			msgIDs[id] = true
+		}
+	}
+	seek := binary.BigEndian.AppendUint64(append([]byte(nil), prefix...), unixNanos(since))
+	if after := append(append([]byte(nil), prefix...), filter.After...); len(filter.After) > 0 && bytes.Compare(after, seek) > 0 {
+		seek = after
+	}
+	end := unixNanos(until)
+	return mdb.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+			pos := it.Item().Key()[len(prefix):]
+			if len(pos) != cursorSize || (len(filter.After) > 0 && bytes.Equal(pos, filter.After)) {
+				continue
+			}
+			if binary.BigEndian.Uint64(pos) > end {
+				break
+			}
+			key := pos[8:]
+			if msgIDs != nil || filter.Key != nil {
+				mk, err := DecodeKey(key)
+				if err != nil || (msgIDs != nil && !msgIDs[mk.MsgID]) || (filter.Key != nil && !filter.Key(mk)) {
+					continue
+				}
+			}
+			item, err := txn.Get(key)
+			if err == badger.ErrKeyNotFound {
+				continue // removed by dedupe
+			} else if err != nil {
+				return err
+			}
+			if err := fn(&MsgItem{item: item, cursor: append([]byte(nil), pos...)}); err != nil {
+				if err == ErrStopIteration {
+					break
+				}
+				log.Println(err)
+			}
+		}
+		return nil
+	})
+}
+
+// PeerItem is a msg listed by IteratePeers.
+type PeerItem struct {
+	Peer   string // empty for msgs logged without peer address
+	ConnID string
+	Key    *MsgKey
+}
+
+// IteratePeers calls fn with the msgs of a SimNo between since and until,
+// grouped by peer address and in timestamp order within a peer, without
+// reading the msgs.
+func (mdb *MsgDB) IteratePeers(simNo string, since, until time.Time, fn func(*PeerItem) error) error {
+	simKey, err := (&MsgKey{SimNo: simNo}).Encode()
+	if err != nil {
+		return err
+	}
+	prefix := append(append([]byte(nil), peerIndexPrefix...), simKey[:SimNoBytes]...)
+	start, end := unixNanos(since), unixNanos(until)
+	return mdb.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); {
+			item := it.Item()
+			rest := item.Key()[len(prefix):]
+			if len(rest) < 1 || len(rest) != 1+int(rest[0])+cursorSize {
+				it.Next()
+				continue
+			}
+			peerPrefix := item.KeyCopy(nil)[:len(prefix)+1+int(rest[0])]
+			pos := rest[1+int(rest[0]):]
+			if ts := binary.BigEndian.Uint64(pos); ts < start {
+				it.Seek(binary.BigEndian.AppendUint64(peerPrefix, start))
+				continue
+			} else if ts > end {
+				// past every key of the peer
+				it.Seek(append(peerPrefix, bytes.Repeat([]byte{0xFF}, cursorSize)...))
+				continue
+			}
+			mk, err := DecodeKey(pos[8:])
+			if err != nil {
+				it.Next()
+				continue
+			}
+			pi := &PeerItem{Peer: string(peerPrefix[len(prefix)+1:]), Key: mk}
+			if err := item.Value(func(val []byte) error {
+				pi.ConnID = string(val)
+				return nil
+			}); err != nil {
+				return err
+			}
+			if err := fn(pi); err != nil {
+				if err == ErrStopIteration {
+					break
+				}
+				log.Println(err)
+			}
+			it.Next()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,182 @@
+package msg
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func scanSNs(t *testing.T, mdb *MsgDB, since, until time.Time, filter *ScanFilter, limit int) (sns []uint32, cursor []byte) {
+	if err := mdb.IterateAll(since, until, filter, func(mi *MsgItem) error {
+		if len(sns) == limit {
+			return ErrStopIteration
+		}
+		mk, err := mi.Key()
+		if err != nil {
+			return err
+		}
+		sns, cursor = append(sns, mk.SN), mi.Cursor()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return sns, cursor
+}
+
+func TestIterateAll(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	base := time.Date(2023, 4, 25, 10, 0, 0, 0, time.UTC)
+	b := mdb.NewBatch()
+	// SNs follow the order of the timestamps, not of the SimNos
+	for i, rec := range []struct {
+		raw    string
+		offset time.Duration
+	}{
+		{"7E000200000138001380000001A97E", 0},                         // 13800138000 heartbeat
+		{"7E000200000138001380010001A87E", time.Minute},               // 13800138001 heartbeat
+		{"7E8001000501380013800000010001000200017E", 2 * time.Minute}, // 13800138000 0x8001
+		{"7E000200000138001380010001A87E", 10 * time.Minute},          // out of range
+		{"7E000200000138001380000001A97E", -time.Minute},              // before range
+		{"7E8001000501380013800100010001000200007E", 3 * time.Minute}, // 13800138001 0x8001
+	} {
+		if err := b.put(newMsgKey(mustDecode(t, rec.raw), base.Add(rec.offset), false, 0, uint32(i)), mustDecode(t, rec.raw), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	until := base.Add(5 * time.Minute)
+
+	if sns, _ := scanSNs(t, mdb, base, until, nil, -1); !equalSNs(sns, 0, 1, 2, 5) {
+		t.Errorf("scan %v", sns)
+	}
+	if sns, _ := scanSNs(t, mdb, base, until, &ScanFilter{MsgIDs: []uint16{0x8001}}, -1); !equalSNs(sns, 2, 5) {
+		t.Errorf("scan 0x8001 %v", sns)
+	}
+	if sns, _ := scanSNs(t, mdb, base, until, &ScanFilter{MsgIDs: []uint16{0x0002, 0x8001}, Key: func(mk *MsgKey) bool {
+		return mk.SimNo == "13800138001"
+	}}, -1); !equalSNs(sns, 1, 5) {
+		t.Errorf("scan 13800138001 %v", sns)
+	}
+	// paging
+	page1, cursor := scanSNs(t, mdb, base, until, nil, 3)
+	page2, _ := scanSNs(t, mdb, base, until, &ScanFilter{After: cursor}, 3)
+	if !equalSNs(page1, 0, 1, 2) || !equalSNs(page2, 5) {
+		t.Errorf("pages %v %v", page1, page2)
+	}
+	if err := mdb.IterateAll(base, until, &ScanFilter{After: []byte{1}}, nil); err != ErrBadCursor {
+		t.Errorf("bad cursor err %v", err)
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	m := mustDecode(t, "7E000200000138001380000001A97E")
+	ts := time.Date(2023, 4, 25, 10, 0, 0, 0, time.UTC)
+	key, err := newMsgKey(m, ts, false, 0, 7).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a msg written before the indexes
+	if err := mdb.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(metaKeyIndex); err != nil {
+			return err
+		}
+		return txn.Set(key, encodeMsgValue(m))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sns, _ := scanSNs(t, mdb, ts, ts, nil, -1); len(sns) != 0 {
+		t.Errorf("scan before build %v", sns)
+	}
+	if err := buildIndex(mdb.db); err != nil {
+		t.Fatal(err)
+	}
+	if sns, _ := scanSNs(t, mdb, ts, ts, &ScanFilter{MsgIDs: []uint16{0x0002}}, -1); !equalSNs(sns, 7) {
+		t.Errorf("scan after build %v", sns)
+	}
+	if peers := listPeers(t, mdb, ts, ts); len(peers) != 1 || peers[0] != "//7" {
+		t.Errorf("peers after build %v", peers)
+	}
+}
+
+// listPeers lists the msgs of 13800138000 in the peer index as peer/conn/SN.
+func listPeers(t *testing.T, mdb *MsgDB, since, until time.Time) (peers []string) {
+	if err := mdb.IteratePeers("13800138000", since, until, func(pi *PeerItem) error {
+		peers = append(peers, fmt.Sprintf("%s/%s/%d", pi.Peer, pi.ConnID, pi.Key.SN))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return peers
+}
+
+func TestIteratePeers(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	base := time.Date(2023, 4, 25, 10, 0, 0, 0, time.UTC)
+	b := mdb.NewBatch()
+	for i, rec := range []struct {
+		peer, conn string
+		offset     time.Duration
+	}{
+		{"10.0.0.2:4000", "conn-2", 0},
+		{"10.0.0.1:5000", "conn-1", time.Minute},
+		{"", "", 2 * time.Minute},
+		{"10.0.0.1:5000", "conn-3", 3 * time.Minute},
+		{"10.0.0.1:5000", "conn-1", -time.Minute}, // before range
+		{"10.0.0.2:4000", "conn-2", time.Hour},    // after range
+		{"10.0.0.1:500", "conn-4", 4 * time.Minute},
+	} {
+		m := mustDecode(t, "7E000200000138001380000001A97E")
+		m.Extra = map[string]string{}
+		if rec.peer != "" {
+			m.Extra[ExtraPeer], m.Extra[ExtraConn] = rec.peer, rec.conn
+		}
+		if err := b.put(newMsgKey(m, base.Add(rec.offset), false, 0, uint32(i)), m, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	peers := listPeers(t, mdb, base, base.Add(5*time.Minute))
+	want := []string{"//2", "10.0.0.1:500/conn-4/6", "10.0.0.1:5000/conn-1/1", "10.0.0.1:5000/conn-3/3", "10.0.0.2:4000/conn-2/0"}
+	if fmt.Sprint(peers) != fmt.Sprint(want) {
+		t.Errorf("peers %v, want %v", peers, want)
+	}
+}
+
+func mustDecode(t *testing.T, raw string) *Msg {
+	m, err := Decode(mustDecodeHexString(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func equalSNs(sns []uint32, want ...uint32) bool {
+	if len(sns) != len(want) {
+		return false
+	}
+	for i := range sns {
+		if sns[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
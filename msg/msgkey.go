@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -11,6 +12,8 @@ import (
 
 const SimNoBytes = 10
 
+var ErrBadSimNo = errors.New("bad simNo")
+
 type MsgKey struct {
 	SimNo     string
 	Timestamp time.Time
@@ -22,6 +25,9 @@ type MsgKey struct {
 	PartTotal uint16
 }
 
+// MsgKeyLayout is the encoded form of MsgKey, Timestamp is in Unix
+// nanoseconds if MsgKeyFlag_Nano is set, or in Unix seconds for keys written
+// before the flag was introduced.
 type MsgKeyLayout struct {
 	SimNo     [SimNoBytes]byte
 	Timestamp uint64
@@ -36,16 +42,44 @@ type MsgKeyLayout struct {
 
 const (
 	MsgKeyFlag_Tx = (1 << iota)
+	MsgKeyFlag_Nano
 )
 
-func DecodeKey(b []byte) (*MsgKey, error) {
+var msgKeySize = binary.Size(MsgKeyLayout{})
+
+func newMsgKey(m *Msg, timestamp time.Time, tx bool, ds uint8, sn uint32) *MsgKey {
+	return &MsgKey{
+		SimNo:     m.SimNo,
+		Timestamp: timestamp,
+		TX:        tx,
+		DS:        ds,
+		SN:        sn,
+		MsgID:     m.MsgID,
+		PartIndex: m.PartIndex,
+		PartTotal: m.PartTotal,
+	}
+}
+
+func decodeKeyLayout(b []byte) (*MsgKeyLayout, error) {
 	var s MsgKeyLayout
 	if err := binary.Read(bytes.NewReader(b), binary.BigEndian, &s); err != nil {
 		return nil, err
 	}
+	return &s, nil
+}
+
+func DecodeKey(b []byte) (*MsgKey, error) {
+	s, err := decodeKeyLayout(b)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := time.Unix(int64(s.Timestamp), 0)
+	if (s.Flags & MsgKeyFlag_Nano) != 0 {
+		timestamp = time.Unix(0, int64(s.Timestamp))
+	}
 	mk := &MsgKey{
 		SimNo:     strings.TrimLeft(hex.EncodeToString(s.SimNo[:]), "0"),
-		Timestamp: time.Unix(int64(s.Timestamp), 0),
+		Timestamp: timestamp,
 		DS:        s.DS,
 		TX:        (s.Flags & MsgKeyFlag_Tx) != 0,
 		SN:        s.SN,
@@ -57,20 +91,25 @@ func DecodeKey(b []byte) (*MsgKey, error) {
 }
 
 func (mk *MsgKey) Encode() ([]byte, error) {
+	var timestamp uint64
+	if mk.Timestamp.Unix() > 0 {
+		timestamp = uint64(mk.Timestamp.UnixNano())
+	}
 	s := MsgKeyLayout{
-		Timestamp: uint64(mk.Timestamp.UTC().Unix()),
+		Timestamp: timestamp,
 		DS:        mk.DS,
+		Flags:     MsgKeyFlag_Nano,
 		SN:        mk.SN,
 		MsgID:     mk.MsgID,
 		PartIndex: mk.PartIndex,
 		PartTotal: mk.PartTotal,
 	}
 	if len(mk.SimNo) > SimNoBytes*2 {
-		return nil, fmt.Errorf("simNo too long (>%d chars)", SimNoBytes*2)
+		return nil, fmt.Errorf("%w: too long (>%d chars)", ErrBadSimNo, SimNoBytes*2)
 	}
 	simNo, err := hex.DecodeString(strings.Repeat("0", SimNoBytes*2-len(mk.SimNo)) + mk.SimNo)
 	if err != nil {
-		return nil, fmt.Errorf("simNo contains non-hex chars: %w", err)
+		return nil, fmt.Errorf("%w: non-hex chars: %v", ErrBadSimNo, err)
 	}
 	if err != nil {
 		return nil, err
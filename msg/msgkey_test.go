@@ -1,6 +1,8 @@
 package msg
 
 import (
+	"bytes"
+	"encoding/binary"
 	"testing"
 	"time"
 )
@@ -30,3 +32,46 @@ func TestDecodeAndDecodeKey(t *testing.T) {
 		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
 	}
 }
+
+func TestDecodeKeyNanoAndLegacy(t *testing.T) {
+	ts := time.Unix(1682391699, 123456789)
+	b, err := (&MsgKey{SimNo: "12345678901", Timestamp: ts}).Encode()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	decoded, err := DecodeKey(b)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !decoded.Timestamp.Equal(ts) {
+		t.Errorf("timestamp mismatch: %s != %s", decoded.Timestamp, ts)
+	}
+	legacy := encodeLegacyKey(&MsgKey{SimNo: "12345678901", Timestamp: ts})
+	decoded, err = DecodeKey(legacy)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !decoded.Timestamp.Equal(ts.Truncate(time.Second)) {
+		t.Errorf("legacy timestamp mismatch: %s != %s", decoded.Timestamp, ts)
+	}
+}
+
+// encodeLegacyKey encodes mk in the layout with timestamp in seconds.
+func encodeLegacyKey(mk *MsgKey) []byte {
+	b, err := mk.Encode()
+	if err != nil {
+		panic(err)
+	}
+	layout, err := decodeKeyLayout(b)
+	if err != nil {
+		panic(err)
+	}
+	layout.Timestamp = uint64(mk.Timestamp.Unix())
+	layout.Flags &^= MsgKeyFlag_Nano
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.BigEndian, layout)
+	return buf.Bytes()
+}
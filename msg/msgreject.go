@@ -0,0 +1,125 @@
+package msg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// RejectTTL is how long rejected lines are kept.
+var RejectTTL = MaxMsgTTL
+
+// Reasons of rejected lines.
+const (
+	RejectUnknownFormat = "unknownFormat"
+	RejectFormat        = "format"
+	RejectTimestamp     = "timestamp"
+	RejectPayload       = "payload"
+	RejectBadMsg        = "badMsg"
+	RejectSimNo         = "simNo"
+	RejectForbiddenDS   = "forbiddenDS"
+)
+
+// Reject is a log line or captured frame which could not be stored as a msg.
+type Reject struct {
+	Time   time.Time         `json:"time"`
+	Reason string            `json:"reason"`
+	Error  string            `json:"error"`
+	Line   string            `json:"line"`
+	DS     uint8             `json:"ds"`
+	Format string            `json:"format,omitempty"`
+	Host   string            `json:"host,omitempty"`
+	File   string            `json:"file,omitempty"`
+	Extra  map[string]string `json:"extra,omitempty"`
+}
+
+// Source is the host, peer or file the rejected line came from, in that
+// order of preference.
+func (r *Reject) Source() string {
+	switch {
+	case r.Host != "":
+		return r.Host
+	case r.Extra[ExtraPeer] != "":
+		return r.Extra[ExtraPeer]
+	default:
+		return r.File
+	}
+}
+
+func newEventReject(line string, tags *msgTags) *Reject {
+	return &Reject{Line: line, DS: tags.DS, Format: tags.Format, Host: tags.Host, File: tags.File}
+}
+
+// rejectKeyPrefix starts the keys of rejects, followed by the arrival time in
+// Unix nanoseconds and the SN. The keys are shorter than msg keys.
+var rejectKeyPrefix = []byte("REJECT")
+
+func encodeRejectKey(t time.Time, sn uint32) []byte {
+	key := make([]byte, len(rejectKeyPrefix)+12)
+	copy(key, rejectKeyPrefix)
+	nanos := t.UnixNano()
+	if nanos < 0 {
+		nanos = 0
+	}
+	binary.BigEndian.PutUint64(key[len(rejectKeyPrefix):], uint64(nanos))
+	binary.BigEndian.PutUint32(key[len(rejectKeyPrefix)+8:], sn)
+	return key
+}
+
+// reject records why a line was not stored and returns err, so that the
+// callers can still log it.
+func (b *Batch) reject(sn uint32, r *Reject, reason string, err error) error {
+	r.Time = time.Now()
+	r.Reason = reason
+	r.Error = err.Error()
+	val, jerr := json.Marshal(r)
+	if jerr != nil {
+		log.Println(fmt.Errorf("reject marshal: %w", jerr))
+		return err
+	}
+	b.entries = append(b.entries, badger.NewEntry(encodeRejectKey(r.Time, sn), val).WithTTL(RejectTTL))
+	return err
+}
+
+// parseRejectReason maps the errors of LogFormat.ParseInLocation to reasons.
+func parseRejectReason(err error) string {
+	switch {
+	case errors.Is(err, ErrLogFormat):
+		return RejectFormat
+	case errors.Is(err, ErrLogTimestamp):
+		return RejectTimestamp
+	case errors.Is(err, ErrLogPayload):
+		return RejectPayload
+	default:
+		return RejectBadMsg
+	}
+}
+
+// IterateRejects calls fn with the rejects arrived since, in arrival order.
+func (mdb *MsgDB) IterateRejects(since time.Time, fn func(*Reject) error) error {
+	return mdb.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(encodeRejectKey(since, 0)); it.ValidForPrefix(rejectKeyPrefix); it.Next() {
+			r := &Reject{}
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, r)
+			}); err != nil {
+				log.Println(fmt.Errorf("decode reject: %w", err))
+				continue
+			}
+			if err := fn(r); err != nil {
+				if err == ErrStopIteration {
+					break
+				}
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,56 @@
+package msg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRejects(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	since := time.Now()
+	tags := newMsgTags()
+	tags.DS, tags.Host = 4, "gw1"
+	for _, line := range []string{
+		"2023-04-25T11:01:39 Rx 7e000200000138001380000001a97e",
+		"20230425110139 Rx 7e00",
+		"20230425110139 Rx 7e000200000138001380000001a97e",
+	} {
+		mdb.handleEventMsg(line, tags)
+	}
+	mdb.handleEventMsg("20230425110139 Rx 7e00", &msgTags{Format: "missing"})
+	mdb.Store(&Record{Raw: []byte{0x7E, 0x00}, Extra: map[string]string{ExtraPeer: "10.0.0.1:52011"}})
+	mdb.flush()
+
+	var rejects []*Reject
+	if err := mdb.IterateRejects(since, func(r *Reject) error {
+		rejects = append(rejects, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ reason, source string }{
+		{RejectFormat, "gw1"},
+		{RejectBadMsg, "gw1"},
+		{RejectUnknownFormat, ""},
+		{RejectBadMsg, "10.0.0.1:52011"},
+	}
+	if len(rejects) != len(want) {
+		t.Fatalf("got %d rejects, want %d", len(rejects), len(want))
+	}
+	for i, w := range want {
+		r := rejects[i]
+		if r.Reason != w.reason || r.Source() != w.source || r.Error == "" || r.Time.Before(since) {
+			t.Errorf("reject %d: %+v, want reason %s source %s", i, r, w.reason, w.source)
+		}
+	}
+	if rejects[0].DS != 4 || rejects[0].Line != "2023-04-25T11:01:39 Rx 7e000200000138001380000001a97e" {
+		t.Errorf("reject 0: %+v", rejects[0])
+	}
+	if rejects[3].Line != "7e00" {
+		t.Errorf("reject 3 line %q", rejects[3].Line)
+	}
+}
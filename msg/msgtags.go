@@ -0,0 +1,148 @@
+package msg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionClasses maps the names accepted by the retention tag to TTLs.
+var RetentionClasses = map[string]time.Duration{
+	"short":    24 * time.Hour,
+	"standard": MaxMsgTTL,
+}
+
+type msgTags struct {
+	DS       uint8
+	TTL      time.Duration
+	Format   string
+	Location *time.Location // set by a tz tag or the source, else nil
+	Host     string
+	File     string
+}
+
+func newMsgTags() *msgTags {
+	return &msgTags{DS: 0, TTL: MaxMsgTTL, Format: DefaultLogFormat}
+}
+
+// location is the zone of the log timestamps without offset.
+func (mt *msgTags) location() *time.Location {
+	if mt.Location != nil {
+		return mt.Location
+	}
+	return DefaultLocation
+}
+
+// set applies a tag, invalid values are ignored.
+func (mt *msgTags) set(k, v string) {
+	switch strings.ToLower(k) {
+	case "ds":
+		v, err := strconv.ParseUint(v, 10, 0)
+		if err == nil && v < 256 {
+			mt.DS = uint8(v)
+		}
+	case "ttl":
+		v, err := time.ParseDuration(v)
+		if err == nil && v <= MaxMsgTTL {
+			mt.TTL = v
+		}
+	case "fmt":
+		mt.Format = v
+	case "tz":
+		loc, err := time.LoadLocation(v)
+		if err == nil {
+			mt.Location = loc
+		}
+	case "retention":
+		if ttl, ok := RetentionClasses[v]; ok {
+			mt.TTL = ttl
+		}
+	}
+}
+
+// setExtra records the source of the log line in m, its zone only if given
+// as Msg.Location falls back to DefaultLocation.
+func (mt *msgTags) setExtra(m *Msg) {
+	tz := ""
+	if mt.Location != nil && mt.Location != time.Local {
+		tz = mt.Location.String() // Local is process dependent
+	}
+	for k, v := range map[string]string{ExtraHost: mt.Host, ExtraFile: mt.File, ExtraTZ: tz} {
+		if v == "" {
+			continue
+		}
+		if m.Extra == nil {
+			m.Extra = make(map[string]string)
+		}
+		m.Extra[k] = v
+	}
+}
+
+func parseMsgTags(tags []string, mt *msgTags) {
+	for _, tag := range tags {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+		mt.set(strings.Trim(k, " \t"), strings.Trim(v, " \t"))
+	}
+}
+
+// parseEvent extracts the log line and tags of a Filebeat event. Tags are
+// read from "tags" and then from "fields", so that fields take precedence.
+func parseEvent(data map[string]any) (string, *msgTags, bool) {
+	return parseEventTags(data, newMsgTags())
+}
+
+// parseEventTags is like parseEvent but applies the event tags over tags.
+func parseEventTags(data map[string]any, tags *msgTags) (string, *msgTags, bool) {
+	msgField, ok := data["message"].(string)
+	if !ok {
+		return "", nil, false
+	}
+	msg := strings.Trim(msgField, "\x00\r\n\t ")
+
+	if tagsField, ok := data["tags"].([]any); ok {
+		list := make([]string, 0, len(tagsField))
+		for _, it := range tagsField {
+			if tag, ok := it.(string); ok {
+				list = append(list, tag)
+			}
+		}
+		parseMsgTags(list, tags)
+	} else if tagsField, ok := data["tags"].([]string); ok {
+		parseMsgTags(tagsField, tags)
+	}
+	if fields, ok := data["fields"].(map[string]any); ok {
+		for k, v := range fields {
+			switch v := v.(type) {
+			case string:
+				tags.set(k, v)
+			case float64:
+				tags.set(k, strconv.FormatFloat(v, 'f', -1, 64))
+			default:
+				tags.set(k, fmt.Sprint(v))
+			}
+		}
+	}
+	if host, ok := lookupEventField(data, "host", "name").(string); ok {
+		tags.Host = host
+	}
+	if file, ok := lookupEventField(data, "log", "file", "path").(string); ok {
+		tags.File = file
+	}
+	return msg, tags, true
+}
+
+func lookupEventField(data map[string]any, path ...string) any {
+	var v any = data
+	for _, name := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
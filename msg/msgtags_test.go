@@ -0,0 +1,95 @@
+package msg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEvent(t *testing.T) {
+	msg, tags, ok := parseEvent(map[string]any{
+		"message": "20230425110139 Rx 7e000200000138001380000001a97e\r\n",
+		"tags":    []any{"ds=2", "ttl=1h", "invalid", "tz=UTC"},
+		"fields":  map[string]any{"ds": float64(3), "retention": "short"},
+		"host":    map[string]any{"name": "gw-01"},
+		"log":     map[string]any{"file": map[string]any{"path": "/var/log/gw/codec.log"}},
+	})
+	if !ok {
+		t.Fatal("event not parsed")
+	}
+	if msg != "20230425110139 Rx 7e000200000138001380000001a97e" {
+		t.Errorf("bad msg: %q", msg)
+	}
+	if tags.DS != 3 || tags.TTL != RetentionClasses["short"] || tags.Location != time.UTC {
+		t.Errorf("bad tags: %+v", tags)
+	}
+	if tags.Host != "gw-01" || tags.File != "/var/log/gw/codec.log" {
+		t.Errorf("bad source: %+v", tags)
+	}
+	if _, _, ok := parseEvent(map[string]any{"tags": []any{"ds=1"}}); ok {
+		t.Errorf("event without message parsed")
+	}
+}
+
+func TestHandleEventMsgSource(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	msg, tags, _ := parseEvent(map[string]any{
+		"message": "20230425030139 Rx 7e000200000138001380000001a97e",
+		"tags":    []any{"tz=UTC"},
+		"host":    map[string]any{"name": "gw-01"},
+	})
+	if err := mdb.handleEventMsg(msg, tags); err != nil {
+		t.Fatal(err)
+	}
+	mdb.flush()
+	found := 0
+	if err := mdb.Iterate("13800138000", time.Time{}, func(mi *MsgItem) error {
+		mk, err := mi.Key()
+		if err != nil {
+			return err
+		}
+		m, err := mi.Value()
+		if err != nil {
+			return err
+		}
+		if !mk.Timestamp.Equal(time.Date(2023, 4, 25, 3, 1, 39, 0, time.UTC)) || m.Extra[ExtraHost] != "gw-01" || m.Location() != time.UTC {
+			t.Errorf("bad msg: %+v, %v", mk, m.Extra)
+		}
+		found++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if found != 1 {
+		t.Errorf("found %d msgs", found)
+	}
+}
+
+func TestDefaultLocation(t *testing.T) {
+	defer func(loc *time.Location) { DefaultLocation = loc }(DefaultLocation)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	m := &Msg{}
+	if loc := m.Location(); loc != BodyLocation {
+		t.Errorf("location %v, want %v", loc, BodyLocation)
+	}
+	DefaultLocation = tokyo
+	tags := newMsgTags()
+	tags.setExtra(m)
+	if _, ok := m.Extra[ExtraTZ]; ok {
+		t.Errorf("default zone stored: %v", m.Extra)
+	}
+	if loc := m.Location(); loc != tokyo {
+		t.Errorf("location %v, want %v", loc, tokyo)
+	}
+	tags.set("tz", "UTC")
+	tags.setExtra(m)
+	if m.Extra[ExtraTZ] != "UTC" || m.Location() != time.UTC {
+		t.Errorf("tagged zone not stored: %v", m.Extra)
+	}
+}
@@ -0,0 +1,165 @@
+package msg
+
+import (
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-lumber/server"
+)
+
+var ErrForbiddenDS = errors.New("ds not allowed for client")
+
+// tlsHandshakeTimeout bounds the TLS handshake of Lumberjack clients.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// ListenOptions configures the TLS of the Lumberjack listener.
+type ListenOptions struct {
+	// TLS enables TLS, set ClientAuth and ClientCAs for mutual TLS.
+	TLS *tls.Config
+	// AllowedDS maps client certificate subjects, either the common name or
+	// the RFC 2253 string of the subject, to the DS values the client may
+	// write. If not empty, clients without a listed subject are refused and
+	// events of other DS values are rejected.
+	AllowedDS map[string][]uint8
+}
+
+// ListenTLS is like Listen but serves Lumberjack over TLS.
+func (mdb *MsgDB) ListenTLS(bind string, lo *ListenOptions) error {
+	if len(lo.AllowedDS) == 0 {
+		s, err := server.ListenAndServe(bind, server.V1(true), server.V2(true), server.TLS(lo.TLS))
+		if err != nil {
+			return err
+		}
+		mdb.goTask(func() { mdb.receiveTask(s, nil, nil) })
+		return nil
+	}
+	l, err := tls.Listen("tcp", bind, lo.TLS)
+	if err != nil {
+		return err
+	}
+	mdb.goTask(func() { mdb.acceptTask(l, lo.AllowedDS) })
+	return nil
+}
+
+// acceptTask serves each client with its own Lumberjack server, so that the
+// events it sends are checked against the DS values of its certificate.
+func (mdb *MsgDB) acceptTask(l net.Listener, allowed map[string][]uint8) {
+	go func() {
+		<-mdb.closeChan
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		tlsConn := conn.(*tls.Conn)
+		mdb.goTask(func() { mdb.handleTLSConn(tlsConn, allowed) })
+	}
+}
+
+func (mdb *MsgDB) handleTLSConn(conn *tls.Conn, allowed map[string][]uint8) {
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		log.Println(fmt.Errorf("lumberjack %s: tls handshake: %w", conn.RemoteAddr(), err))
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		log.Printf("lumberjack %s: refused client without certificate", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+	allowDS, ok := (&ListenOptions{AllowedDS: allowed}).AllowDS(certs[0].Subject)
+	if !ok {
+		log.Printf("lumberjack %s: refused client %s", conn.RemoteAddr(), certs[0].Subject)
+		conn.Close()
+		return
+	}
+	cl := newConnListener(conn)
+	s, err := server.NewWithListener(cl, server.V1(true), server.V2(true))
+	if err != nil {
+		log.Println(fmt.Errorf("lumberjack %s: %w", conn.RemoteAddr(), err))
+		conn.Close()
+		return
+	}
+	mdb.receiveTask(s, allowDS, cl.done)
+}
+
+// AllowDS returns the filter of the DS values a client certificate subject
+// may write, ok is false if the subject is refused. The filter is nil, which
+// accepts every DS, if AllowedDS is empty.
+func (lo *ListenOptions) AllowDS(subject pkix.Name) (allowDS func(uint8) bool, ok bool) {
+	if len(lo.AllowedDS) == 0 {
+		return nil, true
+	}
+	dsList, ok := lo.AllowedDS[subject.CommonName]
+	if !ok || subject.CommonName == "" {
+		if dsList, ok = lo.AllowedDS[subject.String()]; !ok {
+			return nil, false
+		}
+	}
+	return func(ds uint8) bool {
+		for _, v := range dsList {
+			if v == ds {
+				return true
+			}
+		}
+		return false
+	}, true
+}
+
+// connListener is a net.Listener accepting a single established connection,
+// done is closed along with the connection.
+type connListener struct {
+	conn      net.Conn
+	accepted  chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	cl := &connListener{accepted: make(chan net.Conn, 1), done: make(chan struct{})}
+	cl.conn = &listenedConn{Conn: conn, cl: cl}
+	cl.accepted <- cl.conn
+	return cl
+}
+
+func (cl *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-cl.accepted:
+		return conn, nil
+	case <-cl.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (cl *connListener) Close() error {
+	return cl.conn.Close()
+}
+
+func (cl *connListener) Addr() net.Addr {
+	return cl.conn.LocalAddr()
+}
+
+type listenedConn struct {
+	net.Conn
+	cl *connListener
+}
+
+func (lc *listenedConn) Close() error {
+	err := lc.Conn.Close()
+	lc.cl.closeOnce.Do(func() { close(lc.cl.done) })
+	return err
+}
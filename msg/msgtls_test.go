@@ -0,0 +1,159 @@
+package msg
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	v2 "github.com/elastic/go-lumber/client/v2"
+)
+
+// issueCert returns a certificate for cn signed by parent, or self-signed if
+// parent is nil.
+func issueCert(t *testing.T, cn string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestListenTLSAllowedDS(t *testing.T) {
+	ca := issueCert(t, "ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bind := l.Addr().String()
+	l.Close()
+	if err := mdb.ListenTLS(bind, &ListenOptions{
+		TLS: &tls.Config{
+			Certificates: []tls.Certificate{issueCert(t, "loghub", &ca)},
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		},
+		AllowedDS: map[string][]uint8{"gw1": {1}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(cn string, ds string) error {
+		client := issueCert(t, cn, &ca)
+		conn, err := tls.Dial("tcp", bind, &tls.Config{Certificates: []tls.Certificate{client}, RootCAs: pool})
+		if err != nil {
+			return err
+		}
+		c, err := v2.NewSyncClientWithConn(conn, v2.Timeout(5*time.Second))
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		_, err = c.Send([]any{map[string]any{
+			"message": "20230425110139 Rx 7e000200000138001380000001a97e",
+			"tags":    []string{"ds=" + ds},
+		}})
+		return err
+	}
+	if err := send("gw1", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := send("gw1", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := send("gw2", "1"); err == nil {
+		t.Error("client of unlisted subject was not refused")
+	}
+	mdb.flush()
+
+	var ds []uint8
+	if err := mdb.Iterate("13800138000", time.Time{}, func(mi *MsgItem) error {
+		mk, err := mi.Key()
+		if err != nil {
+			return err
+		}
+		ds = append(ds, mk.DS)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0] != 1 {
+		t.Errorf("stored msgs of ds %v, want [1]", ds)
+	}
+	var reasons []string
+	mdb.IterateRejects(time.Time{}, func(r *Reject) error {
+		reasons = append(reasons, r.Reason)
+		return nil
+	})
+	if len(reasons) != 1 || reasons[0] != RejectForbiddenDS {
+		t.Errorf("rejects %v, want [%s]", reasons, RejectForbiddenDS)
+	}
+}
+
+func TestBatchAllowDS(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	lo := &ListenOptions{AllowedDS: map[string][]uint8{"gw-01": {1, 2}}}
+	if _, ok := lo.AllowDS(pkix.Name{CommonName: "gw-02"}); ok {
+		t.Errorf("unlisted subject allowed")
+	}
+	allowDS, ok := lo.AllowDS(pkix.Name{CommonName: "gw-01"})
+	if !ok {
+		t.Fatal("listed subject refused")
+	}
+	b := mdb.NewBatch()
+	b.AllowDS = allowDS
+	if err := b.StoreLog("20230425110139 Rx 7e000200000138001380000001a97e", &LogSource{DS: 2}); err != nil {
+		t.Errorf("allowed ds: %v", err)
+	}
+	if err := b.StoreLog("20230425110140 Rx 7e000200000138001380000001a97e", &LogSource{DS: 3}); !errors.Is(err, ErrForbiddenDS) {
+		t.Errorf("forbidden ds: %v", err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countMsgs(t, mdb, "13800138000"); n != 1 {
+		t.Errorf("%d msgs stored, want 1", n)
+	}
+}
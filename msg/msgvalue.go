@@ -0,0 +1,85 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// msgValueMarker leads the stored value of a msg which has extra fields,
+// values of msgs without extra fields are the raw frame which always starts
+// with 0x7E.
+//
+//	marker | uvarint len | raw | uvarint count | (uvarint len | key | uvarint len | value)...
+const msgValueMarker = 0x00
+
+func encodeMsgValue(m *Msg) []byte {
+	if len(m.Extra) == 0 {
+		return m.Raw
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteByte(msgValueMarker)
+	writeBytes := func(b []byte) {
+		buf.Write(binary.AppendUvarint(nil, uint64(len(b))))
+		buf.Write(b)
+	}
+	writeBytes(m.Raw)
+	keys := make([]string, 0, len(m.Extra))
+	for k := range m.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(keys))))
+	for _, k := range keys {
+		writeBytes([]byte(k))
+		writeBytes([]byte(m.Extra[k]))
+	}
+	return buf.Bytes()
+}
+
+func decodeMsgValue(val []byte) (*Msg, error) {
+	if len(val) == 0 || val[0] != msgValueMarker {
+		return Decode(val)
+	}
+	buf := bytes.NewReader(val[1:])
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(buf.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(buf, b)
+		return b, err
+	}
+	raw, err := readBytes()
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad value: %v", ErrBadMsg, err)
+	}
+	count, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad value: %v", ErrBadMsg, err)
+	}
+	extra := make(map[string]string)
+	for i := uint64(0); i < count; i++ {
+		k, err := readBytes()
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad value: %v", ErrBadMsg, err)
+		}
+		v, err := readBytes()
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad value: %v", ErrBadMsg, err)
+		}
+		extra[string(k)] = string(v)
+	}
+	m, err := Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	m.Extra = extra
+	return m, nil
+}
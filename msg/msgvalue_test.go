@@ -0,0 +1,27 @@
+package msg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeAndDecodeMsgValue(t *testing.T) {
+	raw := mustDecodeHexString("7E 00 02 00 00 01 38 00 13 80 00 00 01 A9 7E")
+	m, err := Decode(raw)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if val := encodeMsgValue(m); !bytes.Equal(val, raw) {
+		t.Errorf("msg without extra not stored raw: %X", val)
+	}
+	m.Extra = map[string]string{"conn": "42", "peer": "10.0.0.1:52011"}
+	decoded, err := decodeMsgValue(encodeMsgValue(m))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if b1, b2, eq := mustMarshalEqual(decoded, m); !eq {
+		t.Errorf("mismatch:\n\t%s\n\t%s\n", string(b1), string(b2))
+	}
+}
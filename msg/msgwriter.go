@@ -0,0 +1,287 @@
+package msg
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Tuning of the write pipeline, set before OpenDB. Up to the bulk size
+// entries are committed at once, waiting at most WriteLatency for them.
+var (
+	WriteLatency   = 50 * time.Millisecond
+	WriteWorkers   = 2
+	WriteQueueSize = 256
+)
+
+var ErrDBClosed = errors.New("msg db closed")
+
+// Batch collects msgs, along with the rejects of lines which failed to parse,
+// to be committed together.
+type Batch struct {
+	// AllowDS rejects the log lines of the DS values it does not accept, nil
+	// accepts every DS.
+	AllowDS func(uint8) bool
+
+	mdb     *MsgDB
+	msgs    []*batchMsg
+	entries []*badger.Entry
+}
+
+// batchMsg is a msg added to a Batch, its entries are added once the
+// duplicates are dropped.
+type batchMsg struct {
+	mk  *MsgKey
+	m   *Msg
+	key []byte
+	ttl time.Duration
+	dh  dedupHash
+}
+
+func (mdb *MsgDB) NewBatch() *Batch {
+	return &Batch{mdb: mdb}
+}
+
+// Commit writes the batch and waits for the commit, a batch is written at
+// most once.
+func (b *Batch) Commit() error {
+	done := make(chan error, 1)
+	if err := b.submit(done); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// commitAsync writes the batch without waiting, errors are logged.
+func (b *Batch) commitAsync() {
+	if err := b.submit(nil); err != nil {
+		log.Println(fmt.Errorf("commit: %w", err))
+	}
+}
+
+// submit drops the duplicated msgs and hands the entries to the writer, done
+// receives the result of the commit if not nil. The SimInfo are updated once
+// the msgs are committed.
+func (b *Batch) submit(done chan<- error) error {
+	if DedupWindow > 0 && len(b.msgs) > 0 {
+		if err := b.dedup(); err != nil {
+			return err
+		}
+	}
+	for _, bm := range b.msgs {
+		b.entries = append(b.entries, badger.NewEntry(bm.key, encodeMsgValue(bm.m)).WithTTL(bm.ttl))
+		keys, values := indexKeys(bm.key, bm.m)
+		for i, indexKey := range keys {
+			b.entries = append(b.entries, badger.NewEntry(indexKey, values[i]).WithTTL(bm.ttl))
+		}
+		if DedupWindow > 0 {
+			b.entries = append(b.entries, badger.NewEntry(encodeDedupKey(bm.dh), bm.key).WithTTL(DedupWindow))
+		}
+	}
+	msgs, entries := b.msgs, b.entries
+	b.msgs, b.entries = nil, nil
+	if len(entries) == 0 {
+		if done != nil {
+			done <- nil
+		}
+		return nil
+	}
+	finish := func(err error) {
+		if DedupWindow > 0 {
+			b.mdb.dedup.release(msgs, err)
+		}
+		if err == nil {
+			for _, bm := range msgs {
+				b.mdb.sims.add(bm.mk, bm.m)
+			}
+		}
+	}
+	if err := b.mdb.writer.submit(entries, func(err error) {
+		finish(err)
+		if done != nil {
+			done <- err
+		}
+	}); err != nil {
+		finish(err)
+		return err
+	}
+	return nil
+}
+
+// WriteStats are the metrics of the write pipeline.
+type WriteStats struct {
+	QueueDepth  int     `json:"queueDepth"` // batches waiting for a worker
+	QueueSize   int     `json:"queueSize"`
+	Pending     int64   `json:"pending"` // entries submitted and not yet committed
+	Committed   uint64  `json:"committed"`
+	Commits     uint64  `json:"commits"`
+	Errors      uint64  `json:"errors"`
+	LastLatency float64 `json:"lastLatencyMs"` // from the oldest batch submitted to its commit
+	Duplicates  uint64  `json:"duplicates"`    // msgs dropped as already stored
+}
+
+func (mdb *MsgDB) WriteStats() WriteStats {
+	ws := mdb.writer.stats()
+	ws.Duplicates = atomic.LoadUint64(&mdb.duplicates)
+	return ws
+}
+
+type writeJob struct {
+	entries   []*badger.Entry
+	submitted time.Time
+	done      func(error) // called with the result of the commit
+}
+
+// writer commits batches with parallel workers, each of which merges the
+// batches queued within WriteLatency into one badger WriteBatch. A full queue
+// blocks the submitters.
+type writer struct {
+	db        *badger.DB
+	bulkSize  int
+	latency   time.Duration
+	jobChan   chan *writeJob
+	closeLock sync.RWMutex
+	closed    bool
+	workers   sync.WaitGroup
+
+	pendingLock sync.Mutex
+	pendingCond *sync.Cond
+	pending     int64
+
+	committed   uint64
+	commits     uint64
+	errors      uint64
+	lastLatency int64
+}
+
+func newWriter(db *badger.DB, bulkSize int) *writer {
+	if bulkSize <= 0 {
+		bulkSize = 1
+	}
+	w := &writer{
+		db:       db,
+		bulkSize: bulkSize,
+		latency:  WriteLatency,
+		jobChan:  make(chan *writeJob, WriteQueueSize),
+	}
+	w.pendingCond = sync.NewCond(&w.pendingLock)
+	workers := WriteWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		w.workers.Add(1)
+		go w.workTask()
+	}
+	return w
+}
+
+func (w *writer) submit(entries []*badger.Entry, done func(error)) error {
+	w.closeLock.RLock()
+	defer w.closeLock.RUnlock()
+	if w.closed {
+		return ErrDBClosed
+	}
+	w.pendingLock.Lock()
+	w.pending += int64(len(entries))
+	w.pendingLock.Unlock()
+	w.jobChan <- &writeJob{entries: entries, submitted: time.Now(), done: done}
+	return nil
+}
+
+func (w *writer) workTask() {
+	defer w.workers.Done()
+	for job := range w.jobChan {
+		jobs, n := []*writeJob{job}, len(job.entries)
+		timer := time.NewTimer(w.latency)
+	collect:
+		for n < w.bulkSize {
+			select {
+			case job, ok := <-w.jobChan:
+				if !ok {
+					break collect
+				}
+				jobs, n = append(jobs, job), n+len(job.entries)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		w.write(jobs, n)
+	}
+}
+
+func (w *writer) write(jobs []*writeJob, n int) {
+	wb := w.db.NewWriteBatch()
+	var err error
+	for _, job := range jobs {
+		for _, e := range job.entries {
+			if err = wb.SetEntry(e); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = wb.Flush()
+	} else {
+		wb.Cancel()
+	}
+	if err != nil {
+		atomic.AddUint64(&w.errors, 1)
+		log.Println(fmt.Errorf("write %d entries: %w", n, err))
+	} else {
+		atomic.AddUint64(&w.committed, uint64(n))
+		atomic.AddUint64(&w.commits, 1)
+	}
+	atomic.StoreInt64(&w.lastLatency, int64(time.Since(jobs[0].submitted)))
+	for _, job := range jobs {
+		job.done(err)
+	}
+	w.pendingLock.Lock()
+	w.pending -= int64(n)
+	w.pendingCond.Broadcast()
+	w.pendingLock.Unlock()
+}
+
+// flush waits until every entry submitted so far is written.
+func (w *writer) flush() {
+	w.pendingLock.Lock()
+	defer w.pendingLock.Unlock()
+	for w.pending > 0 {
+		w.pendingCond.Wait()
+	}
+}
+
+// close writes the queued batches and stops the workers, later submits fail.
+func (w *writer) close() {
+	w.closeLock.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.jobChan)
+	}
+	w.closeLock.Unlock()
+	w.workers.Wait()
+}
+
+func (w *writer) stats() WriteStats {
+	w.pendingLock.Lock()
+	pending := w.pending
+	w.pendingLock.Unlock()
+	return WriteStats{
+		QueueDepth:  len(w.jobChan),
+		QueueSize:   cap(w.jobChan),
+		Pending:     pending,
+		Committed:   atomic.LoadUint64(&w.committed),
+		Commits:     atomic.LoadUint64(&w.commits),
+		Errors:      atomic.LoadUint64(&w.errors),
+		LastLatency: float64(atomic.LoadInt64(&w.lastLatency)) / float64(time.Millisecond),
+	}
+}
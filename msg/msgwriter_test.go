@@ -0,0 +1,80 @@
+package msg
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	v2 "github.com/elastic/go-lumber/client/v2"
+)
+
+func countMsgs(t *testing.T, mdb *MsgDB, simNo string) int {
+	n := 0
+	if err := mdb.Iterate(simNo, time.Time{}, func(mi *MsgItem) error {
+		n++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestBatchCommit(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	b := mdb.NewBatch()
+	for i := 0; i < 25; i++ {
+		if err := b.StoreLog(fmt.Sprintf("202304251101%02d Rx 7e000200000138001380000001a97e", i), &LogSource{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countMsgs(t, mdb, "13800138000"); n != 0 {
+		t.Errorf("%d msgs visible before commit", n)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countMsgs(t, mdb, "13800138000"); n != 25 {
+		t.Errorf("%d msgs visible after commit, want 25", n)
+	}
+	if ws := mdb.WriteStats(); ws.Committed < 25 || ws.Pending != 0 || ws.Errors != 0 {
+		t.Errorf("write stats %+v", ws)
+	}
+}
+
+func TestReceiveAckAfterCommit(t *testing.T) {
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bind := l.Addr().String()
+	l.Close()
+	if err := mdb.Listen(bind); err != nil {
+		t.Fatal(err)
+	}
+	c, err := v2.SyncDial(bind, v2.Timeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	events := make([]any, 3)
+	for i := range events {
+		events[i] = map[string]any{"message": fmt.Sprintf("202304251101%02d Rx 7e000200000138001380000001a97e", i)}
+	}
+	if _, err := c.Send(events); err != nil {
+		t.Fatal(err)
+	}
+	// acknowledged batches are readable without waiting for a flush
+	if n := countMsgs(t, mdb, "13800138000"); n != 3 {
+		t.Errorf("%d msgs visible after ack, want 3", n)
+	}
+}
@@ -0,0 +1,93 @@
+package msg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// VersionAny registers a body type for every protocol version.
+const VersionAny int16 = math.MinInt16
+
+// BodyDecodeFunc decodes a body, loc is the zone of the BCD times in it.
+type BodyDecodeFunc func(raw []byte, version int16, loc *time.Location) (any, error)
+
+type BodyFilterFunc func(body any) bool
+
+// BodyFilterFactory creates a filter of decoded bodies from query params, nil
+// is returned if the params select every body.
+type BodyFilterFactory func(query url.Values) BodyFilterFunc
+
+type BodyType struct {
+	MsgID     uint16
+	Version   int16
+	Decode    BodyDecodeFunc
+	NewFilter BodyFilterFactory // optional
+}
+
+type bodyTypeKey struct {
+	MsgID   uint16
+	Version int16
+}
+
+var (
+	bodyTypesLock sync.RWMutex
+	bodyTypes     = make(map[bodyTypeKey]*BodyType)
+)
+
+var ErrUnknownBody = errors.New("unknown body")
+
+// RegisterBody registers the decoder of a msg body, it panics if the msg id
+// is already registered for the version. Packages providing vendor-private
+// msgs are expected to call it from init.
+func RegisterBody(bt *BodyType) {
+	bodyTypesLock.Lock()
+	defer bodyTypesLock.Unlock()
+	key := bodyTypeKey{MsgID: bt.MsgID, Version: bt.Version}
+	if _, dup := bodyTypes[key]; dup {
+		panic(fmt.Sprintf("msg: body 0x%04X of version %d registered twice", bt.MsgID, bt.Version))
+	}
+	bodyTypes[key] = bt
+}
+
+// LookupBody finds the body type of a msg, types registered for the exact
+// version take precedence over the ones registered for VersionAny.
+func LookupBody(msgID uint16, version int16) (*BodyType, bool) {
+	bodyTypesLock.RLock()
+	defer bodyTypesLock.RUnlock()
+	if bt, ok := bodyTypes[bodyTypeKey{MsgID: msgID, Version: version}]; ok {
+		return bt, true
+	}
+	bt, ok := bodyTypes[bodyTypeKey{MsgID: msgID, Version: VersionAny}]
+	return bt, ok
+}
+
+// DecodeBody decodes a msg body with the registered decoder, ErrUnknownBody
+// is returned if there is none. BCD times are read in loc, see Msg.Location.
+func DecodeBody(msgID uint16, version int16, raw []byte, loc *time.Location) (any, error) {
+	bt, ok := LookupBody(msgID, version)
+	if !ok {
+		return nil, ErrUnknownBody
+	}
+	return bt.Decode(raw, version, loc)
+}
+
+func init() {
+	builtins := []*BodyType{
+		{MsgID: 0x0001, Decode: func(raw []byte, _ int16, _ *time.Location) (any, error) { return DecodeBody_0001(raw) }},
+		{MsgID: 0x8001, Decode: func(raw []byte, _ int16, _ *time.Location) (any, error) { return DecodeBody_8001(raw) }},
+		{MsgID: 0x0100, Decode: func(raw []byte, version int16, _ *time.Location) (any, error) { return DecodeBody_0100(raw, version) }},
+		{MsgID: 0x8100, Decode: func(raw []byte, _ int16, _ *time.Location) (any, error) { return DecodeBody_8100(raw) }},
+		{MsgID: 0x0102, Decode: func(raw []byte, version int16, _ *time.Location) (any, error) { return DecodeBody_0102(raw, version) }},
+		{MsgID: 0x0200, Decode: func(raw []byte, _ int16, loc *time.Location) (any, error) { return DecodeBody_0200(raw, loc) }, NewFilter: NewBodyFilter_0200},
+		{MsgID: 0x0704, Decode: func(raw []byte, _ int16, loc *time.Location) (any, error) { return DecodeBody_0704(raw, loc) }},
+		{MsgID: 0x0705, Decode: func(raw []byte, _ int16, loc *time.Location) (any, error) { return DecodeBody_0705(raw, loc) }},
+	}
+	for _, bt := range builtins {
+		bt.Version = VersionAny
+		RegisterBody(bt)
+	}
+}
@@ -0,0 +1,34 @@
+package msg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegisterBody(t *testing.T) {
+	RegisterBody(&BodyType{
+		MsgID:   0x0F01,
+		Version: VersionAny,
+		Decode:  func(raw []byte, _ int16, _ *time.Location) (any, error) { return "any", nil },
+	})
+	RegisterBody(&BodyType{
+		MsgID:   0x0F01,
+		Version: 1,
+		Decode:  func(raw []byte, _ int16, _ *time.Location) (any, error) { return "v1", nil },
+	})
+	if body, err := DecodeBody(0x0F01, -1, nil, BodyLocation); err != nil || body != "any" {
+		t.Errorf("decoded %v, %v for version -1", body, err)
+	}
+	if body, err := DecodeBody(0x0F01, 1, nil, BodyLocation); err != nil || body != "v1" {
+		t.Errorf("decoded %v, %v for version 1", body, err)
+	}
+	if _, err := DecodeBody(0x0F02, 1, nil, BodyLocation); err != ErrUnknownBody {
+		t.Errorf("unregistered body decoded: %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("duplicated registration accepted")
+		}
+	}()
+	RegisterBody(&BodyType{MsgID: 0x0F01, Version: 1})
+}
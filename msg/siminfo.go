@@ -0,0 +1,239 @@
+package msg
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type SimLocation struct {
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Time      time.Time `json:"time"`      // reported by the terminal
+	Timestamp time.Time `json:"timestamp"` // of the 0x0200 msg
+}
+
+// SimInfo summarizes the msgs received for a SimNo.
+type SimInfo struct {
+	SimNo        string           `json:"simNo"`
+	FirstSeen    time.Time        `json:"firstSeen"`
+	LastSeen     time.Time        `json:"lastSeen"`
+	Counts       map[uint8]uint64 `json:"counts"` // msgs received per DS
+	LastMsgID    uint16           `json:"lastMsgId"`
+	LastLocation *SimLocation     `json:"lastLocation,omitempty"`
+	updated      time.Time
+}
+
+// Count is the number of msgs received over every DS.
+func (si *SimInfo) Count() uint64 {
+	var n uint64
+	for _, c := range si.Counts {
+		n += c
+	}
+	return n
+}
+
+func (si *SimInfo) copy() SimInfo {
+	c := *si
+	c.Counts = make(map[uint8]uint64, len(si.Counts))
+	for ds, n := range si.Counts {
+		c.Counts[ds] = n
+	}
+	if si.LastLocation != nil {
+		loc := *si.LastLocation
+		c.LastLocation = &loc
+	}
+	return c
+}
+
+// simKeyPrefix starts the keys of SimInfo entries, followed by the SimNo.
+// The keys are shorter than msg keys.
+var simKeyPrefix = []byte("SIMS")
+
+// simIndexVersion is stored under metaKeySims when the SimInfo entries are
+// written on close. It is removed once they are loaded, so the entries are
+// built again from the msgs after a crash.
+const simIndexVersion = 1
+
+var metaKeySims = []byte("SIMINDEX")
+
+// simFlushInterval is how often the changed SimInfo entries are written.
+const simFlushInterval = 10 * time.Second
+
+// simIndex keeps the SimInfo of every SimNo in memory, updated as msgs are
+// committed. The changed ones are written periodically and expire MaxMsgTTL
+// after their last msg.
+type simIndex struct {
+	lock  sync.Mutex
+	sims  map[string]*SimInfo
+	dirty map[string]bool
+}
+
+func (si *simIndex) add(mk *MsgKey, m *Msg) {
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	info, ok := si.sims[mk.SimNo]
+	if !ok {
+		info = &SimInfo{SimNo: mk.SimNo, FirstSeen: mk.Timestamp, LastSeen: mk.Timestamp, Counts: make(map[uint8]uint64)}
+		si.sims[mk.SimNo] = info
+	}
+	info.Counts[mk.DS]++
+	info.updated = time.Now()
+	if mk.Timestamp.Before(info.FirstSeen) {
+		info.FirstSeen = mk.Timestamp
+	}
+	if !mk.Timestamp.Before(info.LastSeen) {
+		info.LastSeen, info.LastMsgID = mk.Timestamp, mk.MsgID
+	}
+	if m.MsgID == 0x0200 && m.PartTotal <= 1 && (info.LastLocation == nil || !mk.Timestamp.Before(info.LastLocation.Timestamp)) {
+		if body, err := DecodeBody_0200(m.Body, m.Location()); err == nil {
+			info.LastLocation = &SimLocation{Latitude: body.Latitude, Longitude: body.Longitude, Time: body.Time, Timestamp: mk.Timestamp}
+		}
+	}
+	si.dirty[mk.SimNo] = true
+}
+
+func (si *simIndex) list() []SimInfo {
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	sims := make([]SimInfo, 0, len(si.sims))
+	for _, info := range si.sims {
+		sims = append(sims, info.copy())
+	}
+	return sims
+}
+
+// load reads the SimInfo entries written on close, or builds them from the
+// msgs if the DB was not closed cleanly or written before they were
+// introduced.
+func (si *simIndex) load(db *badger.DB) error {
+	si.sims, si.dirty = make(map[string]*SimInfo), make(map[string]bool)
+	built := false
+	if err := db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(metaKeySims); err == nil {
+			built = true
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		if !built {
+			return nil
+		}
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(simKeyPrefix); it.ValidForPrefix(simKeyPrefix); it.Next() {
+			info := &SimInfo{}
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, info)
+			}); err != nil {
+				log.Println(fmt.Errorf("decode sim info: %w", err))
+				continue
+			}
+			info.updated = time.Now()
+			si.sims[info.SimNo] = info
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if !built {
+		return si.rebuild(db)
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(metaKeySims)
+	})
+}
+
+// rebuild replaces the SimInfo entries with the ones built from the msgs.
+func (si *simIndex) rebuild(db *badger.DB) error {
+	si.lock.Lock()
+	si.sims, si.dirty = make(map[string]*SimInfo), make(map[string]bool)
+	si.lock.Unlock()
+	if err := db.DropPrefix(simKeyPrefix); err != nil {
+		return err
+	}
+	if err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if len(item.Key()) != msgKeySize || item.IsDeletedOrExpired() {
+				continue
+			}
+			mk, err := DecodeKey(item.Key())
+			if err != nil {
+				continue
+			}
+			m := &Msg{MsgID: mk.MsgID, PartTotal: mk.PartTotal}
+			if mk.MsgID == 0x0200 {
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if m, err = decodeMsgValue(val); err != nil {
+					continue
+				}
+			}
+			si.add(mk, m)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := si.flush(db); err != nil {
+		return err
+	}
+	if len(si.sims) > 0 {
+		log.Printf("indexed %d sims", len(si.sims))
+	}
+	return nil
+}
+
+// close writes the changed SimInfo entries and marks them complete.
+func (si *simIndex) close(db *badger.DB) error {
+	if err := si.flush(db); err != nil {
+		return err
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set(metaKeySims, []byte{simIndexVersion})
+	})
+}
+
+// flush writes the changed SimInfo entries and forgets the ones expired.
+func (si *simIndex) flush(db *badger.DB) error {
+	si.lock.Lock()
+	entries := make([]*badger.Entry, 0, len(si.dirty))
+	for simNo := range si.dirty {
+		val, err := json.Marshal(si.sims[simNo])
+		if err != nil {
+			si.lock.Unlock()
+			return err
+		}
+		key := append(append(make([]byte, 0, len(simKeyPrefix)+len(simNo)), simKeyPrefix...), simNo...)
+		entries = append(entries, badger.NewEntry(key, val).WithTTL(MaxMsgTTL))
+	}
+	si.dirty = make(map[string]bool)
+	for simNo, info := range si.sims {
+		if time.Since(info.updated) > MaxMsgTTL {
+			delete(si.sims, simNo)
+		}
+	}
+	si.lock.Unlock()
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, e := range entries {
+		if err := wb.SetEntry(e); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// Sims lists the SimInfo of the SimNos received within MaxMsgTTL.
+func (mdb *MsgDB) Sims() []SimInfo {
+	return mdb.sims.list()
+}
@@ -0,0 +1,155 @@
+package msg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestSims(t *testing.T) {
+	dir := t.TempDir()
+	mdb, err := OpenDB(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2023, 4, 25, 10, 0, 0, 0, time.UTC)
+	heartbeat := mustDecode(t, "7E000200000138001380000001A97E")
+	body, err := EncodeBody_0200(&MsgBody_0200{Latitude: 22.5, Longitude: 114.25, Time: base}, BodyLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := *heartbeat
+	m.MsgID, m.Body = 0x0200, body
+	raw, err := Encode(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := mdb.NewBatch()
+	for i, rec := range []struct {
+		m      *Msg
+		offset time.Duration
+		ds     uint8
+	}{
+		{heartbeat, time.Minute, 0},
+		{location, 0, 0},
+		{heartbeat, 2 * time.Minute, 1},
+		{heartbeat, 2 * time.Minute, 1}, // duplicate
+		{mustDecode(t, "7E8001000501380013800100010001000200007E"), 0, 0},
+	} {
+		if err := b.put(newMsgKey(rec.m, base.Add(rec.offset), false, rec.ds, uint32(i)), rec.m, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	check := func(mdb *MsgDB) {
+		t.Helper()
+		sims := map[string]SimInfo{}
+		for _, si := range mdb.Sims() {
+			sims[si.SimNo] = si
+		}
+		if len(sims) != 2 {
+			t.Fatalf("sims %v", sims)
+		}
+		si := sims["13800138000"]
+		if !si.FirstSeen.Equal(base) || !si.LastSeen.Equal(base.Add(2*time.Minute)) || si.LastMsgID != 0x0002 {
+			t.Errorf("sim %+v", si)
+		}
+		if si.Count() != 3 || si.Counts[0] != 2 || si.Counts[1] != 1 {
+			t.Errorf("counts %v", si.Counts)
+		}
+		if loc := si.LastLocation; loc == nil || loc.Latitude != 22.5 || loc.Longitude != 114.25 || !loc.Timestamp.Equal(base) {
+			t.Errorf("location %+v", loc)
+		}
+		if si := sims["13800138001"]; si.Count() != 1 || si.LastMsgID != 0x8001 || si.LastLocation != nil {
+			t.Errorf("sim %+v", si)
+		}
+	}
+	check(mdb)
+	mdb.Close()
+
+	// reloaded
+	if mdb, err = OpenDB(dir, 10); err != nil {
+		t.Fatal(err)
+	}
+	check(mdb)
+	// built from the msgs of a DB written before the sims
+	if err := mdb.db.DropPrefix(simKeyPrefix); err != nil {
+		t.Fatal(err)
+	}
+	if err := mdb.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(metaKeySims)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mdb.sims.load(mdb.db); err != nil {
+		t.Fatal(err)
+	}
+	check(mdb)
+	mdb.Close()
+}
+
+func TestSimsCommitted(t *testing.T) {
+	window := DedupWindow
+	DedupWindow = 0
+	defer func() { DedupWindow = window }()
+	mdb, err := OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mdb.Close()
+	count := func() uint64 {
+		for _, si := range mdb.Sims() {
+			if si.SimNo == "13800138000" {
+				return si.Count()
+			}
+		}
+		return 0
+	}
+	line := "20230425110139 Rx 7e000200000138001380000001a97e"
+	b := mdb.NewBatch()
+	for i := 0; i < 2; i++ {
+		if err := b.StoreLog(line, &LogSource{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := count(); n != 0 {
+		t.Errorf("%d msgs counted before commit", n)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("%d msgs counted, want 2", n)
+	}
+	b = mdb.NewBatch()
+	if err := b.StoreLog("20230425110140 Rx 7e000200000138001380000001a97e", &LogSource{}); err != nil {
+		t.Fatal(err)
+	}
+	b.entries = append(b.entries, badger.NewEntry(make([]byte, 1<<16), nil))
+	if err := b.Commit(); err == nil {
+		t.Fatal("commit succeeded")
+	}
+	if n := count(); n != 2 {
+		t.Errorf("%d msgs counted after a failed commit, want 2", n)
+	}
+	// reloaded after a crash, the entries are not marked complete until close
+	if err := mdb.sims.load(mdb.db); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("%d msgs counted after reload, want 2", n)
+	}
+	if _, err := mdb.Dedupe(false); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("%d msgs counted after dedupe, want 1", n)
+	}
+}
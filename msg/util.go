@@ -5,9 +5,36 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
+// decodeString decodes a GBK encoded STRING field, zero padding is trimmed.
+func decodeString(b []byte) (string, error) {
+	s, err := simplifiedchinese.GBK.NewDecoder().Bytes(bytes.TrimRight(b, "\x00"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(s), " "), nil
+}
+
+var locations sync.Map // of *time.Location by name
+
+// loadLocation is time.LoadLocation with the zones cached.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
 func mustDecodeHexString(s ...string) []byte {
 	b, err := hex.DecodeString(strings.ReplaceAll(strings.Join(s, ""), " ", ""))
 	if err != nil {
@@ -35,3 +62,22 @@ func mustMarshalEqual(a, b any) (ma, mb string, eq bool) {
 	}
 	return string(blob1), string(blob2), bytes.Equal(blob1, blob2)
 }
+
+func splitParam(val string) []string {
+	list := make([]string, 0)
+	for _, it := range strings.Split(val, ",") {
+		if it = strings.TrimSpace(it); it != "" {
+			list = append(list, it)
+		}
+	}
+	return list
+}
+
+func containsString(list []string, s string) bool {
+	for _, it := range list {
+		if it == s {
+			return true
+		}
+	}
+	return false
+}
@@ -10,13 +10,22 @@ import (
 
 type msgKeyFilterFunc func(*msg.MsgKey) bool
 
-func newMsgIdsFilter(val string) msgKeyFilterFunc {
-	s := mapset.NewThreadUnsafeSet[uint16]()
+type msgFilterFunc func(*msg.Msg) bool
+
+// parseMsgIds parses a comma separated list of MsgIDs, invalid ones are
+// ignored.
+func parseMsgIds(val string) []uint16 {
+	ids := make([]uint16, 0)
 	for _, it := range strings.Split(val, ",") {
 		if id, err := strconv.Atoi(it); err == nil {
-			s.Add(uint16(id))
+			ids = append(ids, uint16(id))
 		}
 	}
+	return ids
+}
+
+func newMsgIdsFilter(val string) msgKeyFilterFunc {
+	s := mapset.NewThreadUnsafeSet[uint16](parseMsgIds(val)...)
 	return func(mk *msg.MsgKey) bool {
 		return s.Cardinality() == 0 || s.Contains(mk.MsgID)
 	}
@@ -40,3 +49,46 @@ func newMsgXferFilter(val string) msgKeyFilterFunc {
 		return !(mk.TX && !tx || !mk.TX && !rx)
 	}
 }
+
+func newMsgPeerFilter(peer, conn string) msgFilterFunc {
+	return func(m *msg.Msg) bool {
+		return (peer == "" || m.Peer() == peer) && (conn == "" || m.ConnID() == conn)
+	}
+}
+
+// keySelection selects msgs by their MsgKey, before their value is read.
+type keySelection []msgKeyFilterFunc
+
+func (ks keySelection) selects(mk *msg.MsgKey) bool {
+	for _, filter := range ks {
+		if !filter(mk) {
+			return false
+		}
+	}
+	return true
+}
+
+// correlates reports whether the msg of mk may be a request or response of
+// a selected msg. General responses are told by the request id in their
+// body, so they are reported if m is nil and has not been read yet.
+func (ks keySelection) correlates(mk *msg.MsgKey, m *msg.Msg) bool {
+	ids := msg.Counterparts(mk.MsgID)
+	if ids == nil {
+		if m == nil {
+			return true
+		}
+		_, replyID, ok := msg.ReplyOf(m)
+		if !ok {
+			return false
+		}
+		ids = []uint16{replyID}
+	}
+	k := *mk
+	k.TX = !mk.TX
+	for _, id := range ids {
+		if k.MsgID = id; ks.selects(&k) {
+			return true
+		}
+	}
+	return false
+}
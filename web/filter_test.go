@@ -0,0 +1,31 @@
+package web
+
+import (
+	"loghub/msg"
+	"testing"
+)
+
+func TestKeySelectionCorrelates(t *testing.T) {
+	// registrations sent by the terminal, and their responses
+	keys := keySelection{newMsgIdsFilter("256"), newMsgXferFilter("rx")}
+	for _, tc := range []struct {
+		mk   msg.MsgKey
+		body []byte
+		want bool
+	}{
+		{msg.MsgKey{MsgID: 0x8100, TX: true}, nil, true},
+		{msg.MsgKey{MsgID: 0x8100}, nil, false},
+		{msg.MsgKey{MsgID: 0x0200, TX: true}, nil, false},
+		{msg.MsgKey{MsgID: 0x8001, TX: true}, nil, true},
+		{msg.MsgKey{MsgID: 0x8001, TX: true}, []byte{0, 1, 0x01, 0x00, 0}, true},
+		{msg.MsgKey{MsgID: 0x8001, TX: true}, []byte{0, 1, 0x02, 0x00, 0}, false},
+	} {
+		var m *msg.Msg
+		if tc.body != nil {
+			m = &msg.Msg{MsgID: tc.mk.MsgID, PartTotal: 1, PartIndex: 1, Body: tc.body}
+		}
+		if got := keys.correlates(&tc.mk, m); got != tc.want {
+			t.Errorf("%04x tx %v body %x: %v, want %v", tc.mk.MsgID, tc.mk.TX, tc.body, got, tc.want)
+		}
+	}
+}
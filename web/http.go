@@ -1,6 +1,9 @@
 package web
 
 import (
+	"crypto/tls"
+	"fmt"
+	"log"
 	"loghub/msg"
 	"loghub/webui"
 	"net/http"
@@ -13,10 +16,31 @@ func init() {
 	gin.SetMode(gin.ReleaseMode)
 }
 
-func Serve(bind string, db *msg.MsgDB) {
+// Serve runs the web server, over TLS if lo is not nil. Client certificates
+// are then verified if given, and required by /api/ingest if lo has client
+// CAs, as are the DS values of the ingested lines if lo has AllowedDS.
+func Serve(bind string, db *msg.MsgDB, lo *msg.ListenOptions) {
+	r := newRouter(db, lo)
+	if lo == nil {
+		go r.Run(bind)
+		return
+	}
+	config := lo.TLS.Clone()
+	if config.ClientCAs != nil {
+		config.ClientAuth = tls.VerifyClientCertIfGiven // the UI needs none
+	}
+	server := &http.Server{Addr: bind, Handler: r, TLSConfig: config}
+	go func() {
+		if err := server.ListenAndServeTLS("", ""); err != nil {
+			log.Println(fmt.Errorf("web: %w", err))
+		}
+	}()
+}
+
+func newRouter(db *msg.MsgDB, lo *msg.ListenOptions) *gin.Engine {
 	r := gin.Default()
 
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	r.Use(compress())
 
 	r.StaticFS("/ui", http.FS(webui.Assets()))
 
@@ -26,8 +50,27 @@ func Serve(bind string, db *msg.MsgDB) {
 
 	r.GET("/api/query", handleRequest(db, queryRaw))
 	r.GET("/api/queryBody", handleRequest(db, queryBody))
+	r.GET("/api/conversations", handleRequest(db, queryConversations))
+	r.GET("/api/peers", handleRequest(db, queryPeers))
+	r.GET("/api/scan", handleRequest(db, queryScan))
+	r.GET("/api/rejects", handleRequest(db, queryRejects))
+	r.GET("/api/sims", handleRequest(db, querySims))
+	r.GET("/api/stats", handleRequest(db, queryStats))
+	r.POST("/api/ingest", handleRequest(db, newIngest(lo)))
 
-	go r.Run(bind)
+	return r
+}
+
+// compress gzips the responses except the streamed ones, whose lines would
+// be held by the compressor as Flush does not reach it.
+func compress() gin.HandlerFunc {
+	gz := gzip.Gzip(gzip.DefaultCompression)
+	return func(c *gin.Context) {
+		if c.Query("format") == "ndjson" {
+			return
+		}
+		gz(c)
+	}
 }
 
 type handleFunc func(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error)
@@ -35,6 +78,9 @@ type handleFunc func(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err err
 func handleRequest(mdb *msg.MsgDB, h handleFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		res, code, err := h(mdb, c)
+		if c.Writer.Written() {
+			return // streamed by h
+		}
 		c.JSON(code, gin.H{"error": err, "result": res})
 	}
 }
@@ -0,0 +1,143 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loghub/msg"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIngestBodySize bounds the body of an ingest request.
+const maxIngestBodySize = 32 << 20
+
+// maxIngestErrors bounds the line errors reported, rejected lines past it are
+// only counted.
+const maxIngestErrors = 100
+
+type ingestError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type ingestResult struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Errors   []ingestError `json:"errors"`
+}
+
+func (ir *ingestResult) reject(line int, err error) {
+	ir.Rejected++
+	if len(ir.Errors) < maxIngestErrors {
+		ir.Errors = append(ir.Errors, ingestError{Line: line, Error: err.Error()})
+	}
+}
+
+// newIngest creates the handler storing a batch of codec log lines pushed by
+// a gateway which cannot run Filebeat. The body is plain text with a log line
+// per line, or NDJSON of Filebeat style events if the content type is
+// application/x-ndjson, in which case the tags and fields of an event take
+// precedence over the query.
+//
+// The client certificate and its DS values are checked as on the Lumberjack
+// listener if lo has client CAs.
+func newIngest(lo *msg.ListenOptions) handleFunc {
+	return func(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
+		var allowDS func(uint8) bool
+		if lo != nil && lo.TLS.ClientCAs != nil {
+			tlsState := c.Request.TLS
+			if tlsState == nil || len(tlsState.VerifiedChains) == 0 {
+				return nil, http.StatusUnauthorized, errors.New("client certificate required")
+			}
+			subject := tlsState.VerifiedChains[0][0].Subject
+			var ok bool
+			if allowDS, ok = lo.AllowDS(subject); !ok {
+				return nil, http.StatusForbidden, fmt.Errorf("client %s not allowed", subject)
+			}
+		}
+		return ingest(mdb, c, allowDS)
+	}
+}
+
+func ingest(mdb *msg.MsgDB, c *gin.Context, allowDS func(uint8) bool) (res any, code int, err error) {
+	var params struct {
+		DS     uint8         `form:"ds"`
+		TTL    time.Duration `form:"ttl"`
+		Format string        `form:"fmt"`
+		TZ     string        `form:"tz"`
+	}
+	if err := c.BindQuery(&params); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if params.TTL < 0 || params.TTL > msg.MaxMsgTTL {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid ttl: exceeds %v", msg.MaxMsgTTL)
+	}
+	src := &msg.LogSource{DS: params.DS, TTL: params.TTL, Format: params.Format}
+	if params.Format != "" {
+		if _, err := msg.LookupLogFormat(params.Format); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+	if params.TZ != "" {
+		if src.Location, err = time.LoadLocation(params.TZ); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid tz: %w", err)
+		}
+	}
+	ndjson := false
+	if ct := c.GetHeader("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return nil, http.StatusUnsupportedMediaType, err
+		}
+		switch mt {
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			ndjson = true
+		}
+	}
+
+	result := &ingestResult{Errors: make([]ingestError, 0)}
+	batch := mdb.NewBatch()
+	batch.AllowDS = allowDS
+	scanner := bufio.NewScanner(http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBodySize))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if ndjson {
+			var event map[string]any
+			if err := json.Unmarshal(line, &event); err != nil {
+				result.reject(lineNo, fmt.Errorf("invalid event: %w", err))
+				continue
+			}
+			err = batch.StoreEvent(event, src)
+		} else {
+			err = batch.StoreLog(string(line), src)
+		}
+		if err != nil {
+			result.reject(lineNo, err)
+			continue
+		}
+		result.Accepted++
+	}
+	// the accepted lines are committed before the response, even if the
+	// rest of the body could not be read
+	if err := batch.Commit(); err != nil {
+		return result, http.StatusInternalServerError, err
+	}
+	if err := scanner.Err(); err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return result, http.StatusRequestEntityTooLarge, err
+		}
+		return result, http.StatusBadRequest, err
+	}
+	return result, http.StatusOK, nil
+}
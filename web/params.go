@@ -0,0 +1,46 @@
+package web
+
+import (
+	"fmt"
+	"loghub/msg"
+	"time"
+)
+
+var timeParamLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+}
+
+// timeRangeParams is embedded in the params of time range queries, "since"
+// and "until" accept RFC 3339 times or "2006-01-02 15:04:05" in the zone given
+// by "tz", which is also the zone of the timestamps returned.
+type timeRangeParams struct {
+	Since string `form:"since" binding:"required"`
+	Until string `form:"until" binding:"required"`
+	TZ    string `form:"tz"`
+}
+
+func (p *timeRangeParams) parse() (since, until time.Time, loc *time.Location, err error) {
+	loc = msg.DefaultLocation
+	if p.TZ != "" {
+		if loc, err = time.LoadLocation(p.TZ); err != nil {
+			return since, until, nil, fmt.Errorf("invalid tz: %w", err)
+		}
+	}
+	if since, err = parseTimeParam(p.Since, loc); err != nil {
+		return since, until, nil, fmt.Errorf("invalid since: %w", err)
+	}
+	if until, err = parseTimeParam(p.Until, loc); err != nil {
+		return since, until, nil, fmt.Errorf("invalid until: %w", err)
+	}
+	return since, until, loc, nil
+}
+
+func parseTimeParam(s string, loc *time.Location) (t time.Time, err error) {
+	for _, layout := range timeParamLayouts {
+		if t, err = time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
@@ -2,17 +2,83 @@ package web
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"loghub/msg"
 	"net/http"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type msgBody_Base struct {
+// msgBody wraps a body decoded by the msg registry, the fields of the body
+// are inlined when marshaled. Bodies carry their own warnings.
+type msgBody struct {
 	Timestamp time.Time `json:"timestamp"`
-	Warnings  []string  `json:"warnings"`
+	Version   int16     `json:"version"`
+	BatchType *uint8    `json:"batchType,omitempty"` // set for items flattened from a 0704 batch
+	MsgID     uint16    `json:"-"`
+	Body      any       `json:"-"`
+}
+
+// msgBodyKeys are the keys of a marshaled msgBody, the inlined fields of a
+// body with the same keys are renamed with a "body" prefix, as "bodyVersion".
+var msgBodyKeys = []string{"timestamp", "version", "batchType"}
+
+func (mb *msgBody) MarshalJSON() ([]byte, error) {
+	type base msgBody
+	head, err := json.Marshal((*base)(mb))
+	if err != nil {
+		return nil, err
+	}
+	blob, err := json.Marshal(mb.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < 2 || blob[0] != '{' {
+		return json.Marshal(&struct {
+			*base
+			Body json.RawMessage `json:"body"`
+		}{(*base)(mb), blob}) // not an object
+	}
+	// splice the fields of the body after those of mb
+	used := make(map[string]bool, len(msgBodyKeys))
+	for _, key := range msgBodyKeys {
+		used[key] = true
+	}
+	spliced := bytes.NewBuffer(make([]byte, 0, len(head)+len(blob)))
+	spliced.Write(head[:len(head)-1])
+	dec := json.NewDecoder(bytes.NewReader(blob))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		for used[key] {
+			key = "body" + strings.ToUpper(key[:1]) + key[1:]
+		}
+		used[key] = true
+		keyJSON, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		spliced.WriteByte(',')
+		spliced.Write(keyJSON)
+		spliced.WriteByte(':')
+		spliced.Write(val)
+	}
+	spliced.WriteByte('}')
+	return spliced.Bytes(), nil
 }
 
 type msgEntry struct {
@@ -20,67 +86,106 @@ type msgEntry struct {
 	Value *msg.Msg
 }
 
-type decodeBodyFunc func(base *msgBody_Base, raw []byte) (any, error)
-type entryFilterFunc func(msg any) bool
+type entryFilterFunc func(body *msgBody) bool
 
-func decodeEntries(entries []*msgEntry) any {
-	base := &msgBody_Base{
-		Timestamp: entries[0].Key.Timestamp,
-		Warnings:  make([]string, 0),
+func decodeEntries(entries []*msgEntry, loc *time.Location) *msgBody {
+	body := &msgBody{
+		Timestamp: entries[0].Key.Timestamp.In(loc),
+		Version:   entries[0].Value.Version,
+		MsgID:     entries[0].Key.MsgID,
 	}
 	buf := &bytes.Buffer{}
 	for _, me := range entries {
 		buf.Write(me.Value.Body)
 	}
-	var decode decodeBodyFunc
-	switch entries[0].Key.MsgID {
-	case 0x0200:
-		decode = decodeBody_0200
-	case 0x0705:
-		decode = decodeBody_0705
-	default:
-		decode = decodeBody_unknown
-	}
-	body, err := decode(base, buf.Bytes())
+	decoded, err := msg.DecodeBody(body.MsgID, body.Version, buf.Bytes(), entries[0].Value.Location())
 	if err != nil {
-		base.Warnings = append(base.Warnings, err.Error())
-		body, _ = decodeBody_unknown(base, buf.Bytes())
+		unknown := &msgBody_Unknown{Data: buf.Bytes(), Warnings: make([]string, 0)}
+		if err != msg.ErrUnknownBody {
+			unknown.Warnings = append(unknown.Warnings, err.Error())
+		}
+		decoded = unknown
 	}
+	setLocation(reflect.ValueOf(decoded), loc)
+	body.Body = decoded
 	return body
 }
 
+var timeType = reflect.TypeOf(time.Time{})
+
+// setLocation converts the times in a decoded body to loc, like the
+// timestamps of the msgs. Times of day without a date are left as they are.
+func setLocation(v reflect.Value, loc *time.Location) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			setLocation(v.Elem(), loc)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			setLocation(v.Index(i), loc)
+		}
+	case reflect.Struct:
+		if v.Type() == timeType {
+			if t := v.Interface().(time.Time); v.CanSet() && t.Year() != 0 {
+				v.Set(reflect.ValueOf(t.In(loc)))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				setLocation(v.Field(i), loc)
+			}
+		}
+	}
+}
+
+// newEntryFilter creates the filter registered for the msg id, filters are
+// looked up for the version of each body as bodies may be versioned.
 func newEntryFilter(msgID uint16, c *gin.Context) entryFilterFunc {
-	switch msgID {
-	case 0x0200:
-		return newEntryFilter_0200(c)
-	default:
-		return func(msg any) bool { return true }
+	query := c.Request.URL.Query()
+	filters := make(map[int16]msg.BodyFilterFunc)
+	return func(body *msgBody) bool {
+		filter, ok := filters[body.Version]
+		if !ok {
+			if bt, found := msg.LookupBody(msgID, body.Version); found && bt.NewFilter != nil {
+				filter = bt.NewFilter(query)
+			}
+			filters[body.Version] = filter
+		}
+		return filter == nil || filter(body.Body)
 	}
 }
 
 func queryBody(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
 	var params struct {
-		SimNo string    `form:"simNo" binding:"required"`
-		Since time.Time `form:"since" time_format:"2006-01-02 15:04:05" binding:"required"`
-		Until time.Time `form:"until" time_format:"2006-01-02 15:04:05" binding:"required"`
-		DS    uint8     `form:"ds"`
-		MsgID uint16    `form:"msgId"`
+		timeRangeParams
+		SimNo string `form:"simNo" binding:"required"`
+		DS    uint8  `form:"ds"`
+		MsgID uint16 `form:"msgId"`
+		// include the items of 0704 batches when querying 0200
+		Flatten bool `form:"flatten"`
 	}
 	if err := c.BindQuery(&params); err != nil {
 		return nil, http.StatusBadRequest, err
 	}
-	list := make([]any, 0)
+	since, until, loc, err := params.parse()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	list := make([]*msgBody, 0)
 	entries := make([]*msgEntry, 0)
 	filter := newEntryFilter(params.MsgID, c)
-	if err := mdb.Iterate(params.SimNo, params.Since, func(mi *msg.MsgItem) error {
+	if err := mdb.Iterate(params.SimNo, since, func(mi *msg.MsgItem) error {
 		mk, err := mi.Key()
 		if err != nil {
 			return fmt.Errorf("decode msgKey: %w", err)
 		}
-		if mk.MsgID != params.MsgID || mk.DS != params.DS {
+		flatten := params.Flatten && params.MsgID == 0x0200 && mk.MsgID == 0x0704
+		if mk.MsgID != params.MsgID && !flatten || mk.DS != params.DS {
 			return nil
 		}
-		if len(entries) == 0 && mk.Timestamp.After(params.Until) {
+		if len(entries) == 0 && mk.Timestamp.After(until) {
 			return msg.ErrStopIteration
 		}
 		if n := len(entries); n > 0 {
@@ -95,8 +200,16 @@ func queryBody(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
 		}
 		entries = append(entries, &msgEntry{Key: mk, Value: m})
 		if len(entries) == int(entries[0].Key.PartTotal) {
-			if item := decodeEntries(entries); filter(item) {
-				list = append(list, item)
+			items := []*msgBody{decodeEntries(entries, loc)}
+			if flatten {
+				// a batch which failed to decode has no 0200 to list
+				batch, _ := items[0].Body.(*msg.MsgBody_0704)
+				items = flattenBatch(items[0], batch)
+			}
+			for _, item := range items {
+				if filter(item) {
+					list = append(list, item)
+				}
 			}
 			entries = make([]*msgEntry, 0)
 		}
@@ -106,3 +219,22 @@ func queryBody(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
 	}
 	return list, http.StatusOK, nil
 }
+
+// flattenBatch returns the items of a 0704 batch as standalone 0200 bodies,
+// none if batch is nil.
+func flattenBatch(mb *msgBody, batch *msg.MsgBody_0704) []*msgBody {
+	if batch == nil {
+		return nil
+	}
+	items := make([]*msgBody, len(batch.Items))
+	for i, it := range batch.Items {
+		items[i] = &msgBody{
+			Timestamp: mb.Timestamp,
+			Version:   mb.Version,
+			BatchType: &batch.Type,
+			MsgID:     0x0200,
+			Body:      it,
+		}
+	}
+	return items
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMsgBodyMarshalJSON(t *testing.T) {
+	ts := time.Date(2023, 4, 25, 11, 1, 39, 0, time.UTC)
+	for _, tc := range []struct {
+		body any
+		want string
+	}{
+		{
+			&struct {
+				Version     int    `json:"version"`
+				BodyVersion string `json:"bodyVersion"`
+				Name        string `json:"name"`
+			}{2, "x", "y"},
+			`{"timestamp":"2023-04-25T11:01:39Z","version":1,"bodyVersion":2,"bodyBodyVersion":"x","name":"y"}`,
+		},
+		{struct{}{}, `{"timestamp":"2023-04-25T11:01:39Z","version":1}`},
+		{[]int{1}, `{"timestamp":"2023-04-25T11:01:39Z","version":1,"body":[1]}`},
+	} {
+		got, err := json.Marshal(&msgBody{Timestamp: ts, Version: 1, Body: tc.body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("got %s, want %s", got, tc.want)
+		}
+	}
+}
+
+func TestQueryBodyFlatten(t *testing.T) {
+	mdb := openTestDB(t,
+		"20230425110139 Rx 7e07040001013800138000000100a97e", // body too short
+		"20230425110140 Rx 7e070400220138001380000002000201001c0000000000000003015e3e9907167866000000000000230816140411005e7e",
+	)
+	w := get(t, mdb, "/api/queryBody", url.Values{
+		"simNo":   {"13800138000"},
+		"since":   {"2023-04-25T00:00:00Z"},
+		"until":   {"2023-04-26T00:00:00Z"},
+		"msgId":   {"512"},
+		"flatten": {"1"},
+	})
+	gz, err := gzipReader(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		Result []map[string]any `json:"result"`
+	}
+	if err := json.NewDecoder(gz).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	// the item decoded before the truncation is kept
+	if len(res.Result) != 1 || res.Result[0]["batchType"] != float64(1) {
+		t.Errorf("result %v", res.Result)
+	}
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"fmt"
+	"loghub/msg"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type conversation struct {
+	Request    *msgRaw   `json:"request"`
+	Responses  []*msgRaw `json:"responses"`
+	Unanswered bool      `json:"unanswered"`
+}
+
+func queryConversations(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
+	var params struct {
+		timeRangeParams
+		SimNo  string        `form:"simNo" binding:"required"`
+		DS     uint8         `form:"ds"`
+		Window time.Duration `form:"window"`
+	}
+	if err := c.BindQuery(&params); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	since, until, loc, err := params.parse()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	correlator := msg.NewCorrelator(params.Window)
+	if err := mdb.Iterate(params.SimNo, since, func(mi *msg.MsgItem) error {
+		mk, err := mi.Key()
+		if err != nil {
+			return fmt.Errorf("decode msgKey: %w", err)
+		}
+		if mk.Timestamp.After(until) {
+			return msg.ErrStopIteration
+		}
+		if mk.DS != params.DS {
+			return nil
+		}
+		m, err := mi.Value()
+		if err != nil {
+			return fmt.Errorf(" decode msg: %w", err)
+		}
+		correlator.Add(mk, m)
+		return nil
+	}); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	conversations := make([]*conversation, 0)
+	orphans := make([]*msgRaw, 0)
+	for _, cm := range correlator.Finish() {
+		switch {
+		case cm.Orphan:
+			mr := newMsgRaw(cm.Key, cm.Msg, loc)
+			mr.setCorrelation(cm)
+			orphans = append(orphans, mr)
+		case cm.IsRequest():
+			req := newMsgRaw(cm.Key, cm.Msg, loc)
+			req.setCorrelation(cm)
+			conv := &conversation{
+				Request:    req,
+				Responses:  make([]*msgRaw, len(cm.Responses)),
+				Unanswered: cm.Unanswered,
+			}
+			for i, resp := range cm.Responses {
+				conv.Responses[i] = newMsgRaw(resp.Key, resp.Msg, loc)
+				conv.Responses[i].setCorrelation(resp)
+			}
+			conversations = append(conversations, conv)
+		}
+	}
+	return gin.H{"conversations": conversations, "orphans": orphans}, http.StatusOK, nil
+}
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"loghub/msg"
+	"net/http"
+	"sort"
+	"time"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/gin-gonic/gin"
+)
+
+type peerSummary struct {
+	Peer      string    `json:"peer"`
+	Conns     []string  `json:"conns"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Count     int       `json:"count"`
+	conns     mapset.Set[string]
+}
+
+// queryPeers lists every distinct remote address a terminal used in the time
+// range, msgs logged without peer address are summarized under "".
+func queryPeers(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
+	var params struct {
+		timeRangeParams
+		SimNo string `form:"simNo" binding:"required"`
+		DS    uint8  `form:"ds"`
+	}
+	if err := c.BindQuery(&params); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	since, until, loc, err := params.parse()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	peers := make(map[string]*peerSummary)
+	if err := mdb.IteratePeers(params.SimNo, since, until, func(pi *msg.PeerItem) error {
+		if pi.Key.DS != params.DS {
+			return nil
+		}
+		ps, ok := peers[pi.Peer]
+		if !ok {
+			ps = &peerSummary{
+				Peer:      pi.Peer,
+				FirstSeen: pi.Key.Timestamp.In(loc),
+				conns:     mapset.NewThreadUnsafeSet[string](),
+			}
+			peers[pi.Peer] = ps
+		}
+		ps.LastSeen = pi.Key.Timestamp.In(loc)
+		ps.Count++
+		if pi.ConnID != "" {
+			ps.conns.Add(pi.ConnID)
+		}
+		return nil
+	}); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	list := make([]*peerSummary, 0, len(peers))
+	for _, ps := range peers {
+		ps.Conns = ps.conns.ToSlice()
+		sort.Strings(ps.Conns)
+		list = append(list, ps)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].FirstSeen.Before(list[j].FirstSeen) })
+	return list, http.StatusOK, nil
+}
@@ -1,6 +1,8 @@
 package web
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"loghub/msg"
 	"net/http"
@@ -11,74 +13,267 @@ import (
 )
 
 type msgRaw struct {
-	Timestamp time.Time `json:"timestamp"`
-	Warnings  []string  `json:"warnings"`
-	Raw       []byte    `json:"raw"`
-	TX        bool      `json:"tx"`
-	DS        uint8     `json:"ds"`
-	SN        uint32    `json:"sn"`
-	MsgID     uint16    `json:"msgId"`
-	MsgSN     uint16    `json:"msgSn"`
-	Version   int16     `json:"version"`
-	Encrypted bool      `json:"encrypted"`
-	PartTotal uint16    `json:"partTotal"`
-	PartIndex uint16    `json:"partIndex"`
+	SimNo      string            `json:"simNo,omitempty"` // set when msgs of several SimNos are listed
+	Timestamp  time.Time         `json:"timestamp"`
+	Warnings   []string          `json:"warnings"`
+	Raw        []byte            `json:"raw"`
+	TX         bool              `json:"tx"`
+	DS         uint8             `json:"ds"`
+	SN         uint32            `json:"sn"`
+	MsgID      uint16            `json:"msgId"`
+	MsgSN      uint16            `json:"msgSn"`
+	Version    int16             `json:"version"`
+	Encrypted  bool              `json:"encrypted"`
+	PartTotal  uint16            `json:"partTotal"`
+	PartIndex  uint16            `json:"partIndex"`
+	Extra      map[string]string `json:"extra,omitempty"`
+	ResponseTo *uint32           `json:"responseTo,omitempty"`
+	Responses  []uint32          `json:"responses,omitempty"`
+	LatencyMs  *int64            `json:"latencyMs,omitempty"`
+	Unanswered bool              `json:"unanswered,omitempty"`
+	Orphan     bool              `json:"orphan,omitempty"`
 }
 
+func newMsgRaw(mk *msg.MsgKey, m *msg.Msg, loc *time.Location) *msgRaw {
+	return &msgRaw{
+		Timestamp: mk.Timestamp.In(loc),
+		Raw:       m.Raw,
+		TX:        mk.TX,
+		DS:        mk.DS,
+		SN:        mk.SN,
+		MsgID:     m.MsgID,
+		MsgSN:     m.MsgSN,
+		Version:   m.Version,
+		Encrypted: m.Encrypted,
+		PartTotal: m.PartTotal,
+		PartIndex: m.PartIndex,
+		Warnings:  m.Warnings,
+		Extra:     m.Extra,
+	}
+}
+
+func (mr *msgRaw) setCorrelation(cm *msg.CorrelatedMsg) {
+	if cm.ResponseTo != nil {
+		sn, latency := cm.ResponseTo.Key.SN, cm.Latency.Milliseconds()
+		mr.ResponseTo, mr.LatencyMs = &sn, &latency
+	}
+	for _, resp := range cm.Responses {
+		mr.Responses = append(mr.Responses, resp.Key.SN)
+	}
+	mr.Unanswered = cm.Unanswered
+	mr.Orphan = cm.Orphan
+}
+
+const (
+	// maxQueryLimit bounds the msgs of a page of /api/query.
+	maxQueryLimit = 10000
+	// correlationLookahead is how far past the last msg of a page, and before
+	// its first one, the msgs are still correlated, so that its requests and
+	// responses are not reported as unanswered or orphans when the other end
+	// falls on the next or previous page.
+	correlationLookahead = time.Minute
+	// streamFlushCount is the number of msgs streamed between flushes.
+	streamFlushCount = 100
+)
+
+// queryRaw lists the msgs of a SimNo in the time range. With "limit", a page
+// of msgs at a time is listed, and its nextCursor is passed as "cursor" to get
+// the next one. Correlation only covers the msgs of a page and those within
+// correlationLookahead around it, and responses within correlationLookahead
+// of their request.
+//
+// With "format=ndjson", the msgs are streamed a line each as they are read,
+// without correlation, and the last line holds the nextCursor of a page or
+// the error which ended the stream.
 func queryRaw(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
 	var params struct {
-		SimNo   string    `form:"simNo" binding:"required"`
-		Since   time.Time `form:"since" time_format:"2006-01-02 15:04:05" binding:"required"`
-		Until   time.Time `form:"until" time_format:"2006-01-02 15:04:05" binding:"required"`
-		DS      uint8     `form:"ds"`
-		MsgIDs  string    `form:"msgIds"`
-		MsgXfer string    `form:"msgXfer"`
+		timeRangeParams
+		SimNo   string `form:"simNo" binding:"required"`
+		DS      uint8  `form:"ds"`
+		MsgIDs  string `form:"msgIds"`
+		MsgXfer string `form:"msgXfer"`
+		Peer    string `form:"peer"`
+		Conn    string `form:"conn"`
+		Limit   int    `form:"limit"`
+		Cursor  string `form:"cursor"`
+		Format  string `form:"format"`
 	}
 	if err := c.BindQuery(&params); err != nil {
 		return nil, http.StatusBadRequest, err
 	}
-	filters := []msgKeyFilterFunc{
-		func(mk *msg.MsgKey) bool { return mk.DS == params.DS },
+	since, until, loc, err := params.parse()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if params.Limit < 0 {
+		params.Limit = 0
+	} else if params.Limit > maxQueryLimit {
+		params.Limit = maxQueryLimit
+	}
+	var after []byte
+	if params.Cursor != "" {
+		if after, err = base64.RawURLEncoding.DecodeString(params.Cursor); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid cursor: %w", err)
+		}
+	}
+	var stream *json.Encoder
+	switch params.Format {
+	case "", "json":
+	case "ndjson":
+		stream = json.NewEncoder(c.Writer)
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid format: %s", params.Format)
+	}
+	keys := keySelection{
 		newMsgIdsFilter(params.MsgIDs),
 		newMsgXferFilter(params.MsgXfer),
 	}
+	msgFilter := newMsgPeerFilter(params.Peer, params.Conn)
 	msgs := make([]*msgRaw, 0)
 	msgIds := mapset.NewThreadUnsafeSet[uint16]()
-	if err := mdb.Iterate(params.SimNo, params.Since, func(mi *msg.MsgItem) error {
+	// the msgs which may be requests or responses of the selected ones are
+	// correlated too, so that links to msgs filtered out are still reported,
+	// and dropped once out of the window
+	correlator := msg.NewCorrelator(correlationLookahead)
+	listed := make(map[*msg.CorrelatedMsg]*msgRaw)
+	setCorrelation := func(cms []*msg.CorrelatedMsg) {
+		for _, cm := range cms {
+			if mr, ok := listed[cm]; ok {
+				mr.setCorrelation(cm)
+				delete(listed, cm)
+			}
+		}
+	}
+	ctx := c.Request.Context()
+	if len(after) > 0 && stream == nil {
+		if err := correlateBefore(mdb, correlator, keys, params.SimNo, params.DS, since, after); err == msg.ErrBadCursor {
+			return nil, http.StatusBadRequest, err
+		} else if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+	count, nextCursor, more := 0, "", false
+	var lookahead time.Time
+	var streamErr error
+	startStream := func() {
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			c.Writer.WriteHeaderNow()
+		}
+	}
+	err = mdb.IterateAfter(params.SimNo, since, after, func(mi *msg.MsgItem) error {
+		if ctx.Err() != nil {
+			return msg.ErrStopIteration // the client is gone
+		}
 		mk, err := mi.Key()
 		if err != nil {
 			return fmt.Errorf("decode msgKey: %w", err)
 		}
-		if mk.Timestamp.After(params.Until) {
+		if mk.Timestamp.After(until) || (more && mk.Timestamp.After(lookahead)) {
 			return msg.ErrStopIteration
 		}
-		msgIds.Add(mk.MsgID)
-		for _, filter := range filters {
-			if !filter(mk) {
-				return nil
-			}
+		if !more {
+			msgIds.Add(mk.MsgID)
+		}
+		if mk.DS != params.DS {
+			return nil
+		}
+		selected := !more && keys.selects(mk)
+		correlated := stream == nil && (selected || keys.correlates(mk, nil))
+		if !selected && !correlated {
+			return nil
 		}
 		m, err := mi.Value()
 		if err != nil {
 			return fmt.Errorf(" decode msg: %w", err)
 		}
-		msgs = append(msgs, &msgRaw{
-			Timestamp: mk.Timestamp,
-			Raw:       m.Raw,
-			TX:        mk.TX,
-			DS:        mk.DS,
-			SN:        mk.SN,
-			MsgID:     m.MsgID,
-			MsgSN:     m.MsgSN,
-			Version:   m.Version,
-			Encrypted: m.Encrypted,
-			PartTotal: m.PartTotal,
-			PartIndex: m.PartIndex,
-			Warnings:  m.Warnings,
-		})
+		var cm *msg.CorrelatedMsg
+		if correlated && (selected || keys.correlates(mk, m)) {
+			setCorrelation(correlator.Expire(mk.Timestamp))
+			cm = correlator.Add(mk, m)
+		}
+		if !selected || !msgFilter(m) {
+			return nil
+		}
+		if params.Limit > 0 && count == params.Limit {
+			more, lookahead = true, mk.Timestamp.Add(correlationLookahead)
+			if stream != nil {
+				return msg.ErrStopIteration
+			}
+			return nil
+		}
+		count++
+		if params.Limit > 0 {
+			nextCursor = base64.RawURLEncoding.EncodeToString(mi.Cursor())
+		}
+		mr := newMsgRaw(mk, m, loc)
+		if stream != nil {
+			startStream()
+			if streamErr = stream.Encode(mr); streamErr != nil {
+				return msg.ErrStopIteration
+			}
+			if count%streamFlushCount == 0 {
+				c.Writer.Flush()
+			}
+			return nil
+		}
+		listed[cm] = mr
+		msgs = append(msgs, mr)
 		return nil
-	}); err != nil {
+	})
+	if !more {
+		nextCursor = ""
+	}
+	// errors before the first line are returned as usual
+	if stream != nil && (err == nil || c.Writer.Written()) {
+		startStream()
+		if err != nil {
+			stream.Encode(gin.H{"error": err.Error()})
+		} else if nextCursor != "" && streamErr == nil && ctx.Err() == nil {
+			stream.Encode(gin.H{"nextCursor": nextCursor})
+		}
+		return nil, http.StatusOK, nil
+	}
+	if err == msg.ErrBadCursor {
+		return nil, http.StatusBadRequest, err
+	} else if err != nil {
 		return nil, http.StatusInternalServerError, err
+	} else if ctx.Err() != nil {
+		return nil, http.StatusInternalServerError, ctx.Err()
+	}
+	setCorrelation(correlator.Finish())
+	return gin.H{"msgs": msgs, "msgIds": msgIds.ToSlice(), "nextCursor": nextCursor}, http.StatusOK, nil
+}
+
+// correlateBefore adds to correlator the msgs of ds within correlationLookahead
+// before the cursor after, the cursor included, which keys correlates,
+// without listing them.
+func correlateBefore(mdb *msg.MsgDB, correlator *msg.Correlator, keys keySelection, simNo string, ds uint8, since time.Time, after []byte) error {
+	mk, err := msg.DecodeKey(after)
+	if err != nil {
+		return msg.ErrBadCursor
 	}
-	return gin.H{"msgs": msgs, "msgIds": msgIds.ToSlice()}, http.StatusOK, nil
+	from := mk.Timestamp.Add(-correlationLookahead)
+	if from.Before(since) {
+		from = since
+	}
+	return mdb.IterateUntil(simNo, from, after, func(mi *msg.MsgItem) error {
+		mk, err := mi.Key()
+		if err != nil {
+			return fmt.Errorf("decode msgKey: %w", err)
+		}
+		if mk.DS != ds || !keys.correlates(mk, nil) {
+			return nil
+		}
+		m, err := mi.Value()
+		if err != nil {
+			return fmt.Errorf("decode msg: %w", err)
+		}
+		if keys.correlates(mk, m) {
+			correlator.Expire(mk.Timestamp)
+			correlator.Add(mk, m)
+		}
+		return nil
+	})
 }
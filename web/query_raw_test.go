@@ -0,0 +1,148 @@
+package web
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"loghub/msg"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func openTestDB(t *testing.T, lines ...string) *msg.MsgDB {
+	t.Helper()
+	mdb, err := msg.OpenDB(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mdb.Close() })
+	b := mdb.NewBatch()
+	for _, line := range lines {
+		if err := b.StoreLog(line, &msg.LogSource{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return mdb
+}
+
+func get(t *testing.T, mdb *msg.MsgDB, path string, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	newRouter(mdb, nil).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: %d %s", path, w.Code, w.Body)
+	}
+	return w
+}
+
+func getPage(t *testing.T, mdb *msg.MsgDB, query url.Values) (msgs []msgRaw, nextCursor string) {
+	t.Helper()
+	w := get(t, mdb, "/api/query", query)
+	var res struct {
+		Result struct {
+			Msgs       []msgRaw `json:"msgs"`
+			NextCursor string   `json:"nextCursor"`
+		} `json:"result"`
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("page not compressed")
+	}
+	gz, err := gzipReader(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewDecoder(gz).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res.Result.Msgs, res.Result.NextCursor
+}
+
+func TestQueryRawPages(t *testing.T) {
+	mdb := openTestDB(t,
+		"20230425110139 Rx 7e000200000138001380000001a97e",
+		"20230425110140 Tx 7e80010005013800138000000100010002002c7e",
+	)
+	query := url.Values{
+		"simNo": {"13800138000"},
+		"since": {"2023-04-25T00:00:00Z"},
+		"until": {"2023-04-26T00:00:00Z"},
+		"limit": {"1"},
+	}
+	var pages []msgRaw
+	for {
+		msgs, nextCursor := getPage(t, mdb, query)
+		pages = append(pages, msgs...)
+		if nextCursor == "" {
+			break
+		}
+		query.Set("cursor", nextCursor)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("%d msgs listed, want 2", len(pages))
+	}
+	if req := pages[0]; req.MsgID != 0x0002 || req.Unanswered || len(req.Responses) != 1 {
+		t.Errorf("request %+v", req)
+	}
+	// its request is on the previous page
+	if resp := pages[1]; resp.MsgID != 0x8001 || resp.Orphan || resp.ResponseTo == nil || *resp.ResponseTo != pages[0].SN {
+		t.Errorf("response %+v", resp)
+	}
+}
+
+func TestQueryRawFiltered(t *testing.T) {
+	mdb := openTestDB(t,
+		"20230425110139 Rx 7e000200000138001380000001a97e",
+		"20230425110140 Tx 7e80010005013800138000000100010002002c7e",
+	)
+	msgs, _ := getPage(t, mdb, url.Values{
+		"simNo":  {"13800138000"},
+		"since":  {"2023-04-25T00:00:00Z"},
+		"until":  {"2023-04-26T00:00:00Z"},
+		"msgIds": {"2"},
+	})
+	// the response is filtered out but still correlated
+	if len(msgs) != 1 || msgs[0].MsgID != 0x0002 || msgs[0].Unanswered || len(msgs[0].Responses) != 1 {
+		t.Errorf("msgs %+v", msgs)
+	}
+}
+
+func TestQueryRawStream(t *testing.T) {
+	mdb := openTestDB(t,
+		"20230425110139 Rx 7e000200000138001380000001a97e",
+		"20230425110140 Tx 7e80010005013800138000000100010002002c7e",
+	)
+	w := get(t, mdb, "/api/query", url.Values{
+		"simNo":  {"13800138000"},
+		"since":  {"2023-04-25T00:00:00Z"},
+		"until":  {"2023-04-26T00:00:00Z"},
+		"limit":  {"1"},
+		"format": {"ndjson"},
+	})
+	// the lines must reach the client as they are flushed
+	if enc := w.Header().Get("Content-Encoding"); enc != "" {
+		t.Fatalf("stream encoded with %s", enc)
+	}
+	var lines []map[string]any
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 || lines[0]["msgId"] != float64(0x0002) || lines[1]["nextCursor"] == nil {
+		t.Errorf("lines %v", lines)
+	}
+}
+
+func gzipReader(w *httptest.ResponseRecorder) (*gzip.Reader, error) {
+	return gzip.NewReader(w.Body)
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"loghub/msg"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultRejectsLimit is the number of rejects listed unless "limit" is given.
+const defaultRejectsLimit = 100
+
+type rejectsResult struct {
+	Total   int                       `json:"total"`
+	Counts  map[string]int            `json:"counts"`
+	Sources map[string]map[string]int `json:"sources"`
+	Rejects []*msg.Reject             `json:"rejects"`
+}
+
+// queryRejects lists the latest lines rejected in the time range, along with
+// counts per reason and per source and reason of all the matching rejects.
+func queryRejects(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
+	var params struct {
+		timeRangeParams
+		Reason string `form:"reason"`
+		Source string `form:"source"`
+		DS     *uint8 `form:"ds"`
+		Limit  int    `form:"limit"`
+	}
+	if err := c.BindQuery(&params); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	since, until, loc, err := params.parse()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if params.Limit <= 0 {
+		params.Limit = defaultRejectsLimit
+	}
+	result := &rejectsResult{
+		Counts:  make(map[string]int),
+		Sources: make(map[string]map[string]int),
+		Rejects: make([]*msg.Reject, 0),
+	}
+	if err := mdb.IterateRejects(since, func(r *msg.Reject) error {
+		if r.Time.After(until) {
+			return msg.ErrStopIteration
+		}
+		if (params.Reason != "" && r.Reason != params.Reason) ||
+			(params.Source != "" && r.Source() != params.Source) ||
+			(params.DS != nil && r.DS != *params.DS) {
+			return nil
+		}
+		result.Total++
+		result.Counts[r.Reason]++
+		source := r.Source()
+		if result.Sources[source] == nil {
+			result.Sources[source] = make(map[string]int)
+		}
+		result.Sources[source][r.Reason]++
+		r.Time = r.Time.In(loc)
+		if len(result.Rejects) == params.Limit {
+			result.Rejects = result.Rejects[1:]
+		}
+		result.Rejects = append(result.Rejects, r)
+		return nil
+	}); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return result, http.StatusOK, nil
+}
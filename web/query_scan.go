@@ -0,0 +1,82 @@
+package web
+
+import (
+	"encoding/base64"
+	"fmt"
+	"loghub/msg"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+)
+
+// queryScan lists the msgs of every SimNo in the time range by timestamp, a
+// page at a time. The nextCursor of a page is passed as "cursor" to get the
+// next one, and is empty on the last page.
+func queryScan(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
+	var params struct {
+		timeRangeParams
+		DS      *uint8 `form:"ds"`
+		MsgIDs  string `form:"msgIds"`
+		MsgXfer string `form:"msgXfer"`
+		Limit   int    `form:"limit"`
+		Cursor  string `form:"cursor"`
+	}
+	if err := c.BindQuery(&params); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	since, until, loc, err := params.parse()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if params.Limit <= 0 {
+		params.Limit = defaultScanLimit
+	} else if params.Limit > maxScanLimit {
+		params.Limit = maxScanLimit
+	}
+	xferFilter := newMsgXferFilter(params.MsgXfer)
+	filter := &msg.ScanFilter{
+		MsgIDs: parseMsgIds(params.MsgIDs),
+		Key: func(mk *msg.MsgKey) bool {
+			return (params.DS == nil || mk.DS == *params.DS) && xferFilter(mk)
+		},
+	}
+	if params.Cursor != "" {
+		if filter.After, err = base64.RawURLEncoding.DecodeString(params.Cursor); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid cursor: %w", err)
+		}
+	}
+	msgs := make([]*msgRaw, 0)
+	nextCursor, more := "", false
+	if err := mdb.IterateAll(since, until, filter, func(mi *msg.MsgItem) error {
+		if len(msgs) == params.Limit {
+			more = true
+			return msg.ErrStopIteration
+		}
+		mk, err := mi.Key()
+		if err != nil {
+			return fmt.Errorf("decode msgKey: %w", err)
+		}
+		m, err := mi.Value()
+		if err != nil {
+			return fmt.Errorf(" decode msg: %w", err)
+		}
+		mr := newMsgRaw(mk, m, loc)
+		mr.SimNo = mk.SimNo
+		msgs = append(msgs, mr)
+		nextCursor = base64.RawURLEncoding.EncodeToString(mi.Cursor())
+		return nil
+	}); err == msg.ErrBadCursor {
+		return nil, http.StatusBadRequest, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if !more {
+		nextCursor = ""
+	}
+	return gin.H{"msgs": msgs, "nextCursor": nextCursor}, http.StatusOK, nil
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"fmt"
+	"loghub/msg"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSimsLimit = 50
+	maxSimsLimit     = 1000
+)
+
+type simsResult struct {
+	Total int           `json:"total"`
+	Sims  []msg.SimInfo `json:"sims"`
+}
+
+// querySims lists the SimNos starting with "prefix", sorted by "sort"
+// (lastSeen, firstSeen, simNo or count) in "order" (asc or desc), a page of
+// "limit" from "offset" at a time.
+func querySims(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
+	var params struct {
+		Prefix string `form:"prefix"`
+		DS     *uint8 `form:"ds"`
+		Sort   string `form:"sort"`
+		Order  string `form:"order"`
+		Limit  int    `form:"limit"`
+		Offset int    `form:"offset"`
+		TZ     string `form:"tz"`
+	}
+	if err := c.BindQuery(&params); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	loc := msg.DefaultLocation
+	if params.TZ != "" {
+		if loc, err = time.LoadLocation(params.TZ); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid tz: %w", err)
+		}
+	}
+	var less func(a, b *msg.SimInfo) bool
+	switch params.Sort {
+	case "", "lastSeen":
+		less = func(a, b *msg.SimInfo) bool { return a.LastSeen.Before(b.LastSeen) }
+	case "firstSeen":
+		less = func(a, b *msg.SimInfo) bool { return a.FirstSeen.Before(b.FirstSeen) }
+	case "simNo":
+		less = func(a, b *msg.SimInfo) bool { return a.SimNo < b.SimNo }
+	case "count":
+		less = func(a, b *msg.SimInfo) bool { return a.Count() < b.Count() }
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid sort: %s", params.Sort)
+	}
+	// SimNos are listed in ascending order, the others latest or largest first
+	desc := params.Sort != "simNo"
+	switch params.Order {
+	case "":
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid order: %s", params.Order)
+	}
+	if params.Limit <= 0 {
+		params.Limit = defaultSimsLimit
+	} else if params.Limit > maxSimsLimit {
+		params.Limit = maxSimsLimit
+	}
+	if params.Offset < 0 {
+		params.Offset = 0
+	}
+
+	sims := mdb.Sims()
+	matched := sims[:0]
+	for _, si := range sims {
+		if !strings.HasPrefix(si.SimNo, params.Prefix) || (params.DS != nil && si.Counts[*params.DS] == 0) {
+			continue
+		}
+		matched = append(matched, si)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := &matched[i], &matched[j]
+		if desc {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		// ties by SimNo so pages are stable
+		return !less(b, a) && matched[i].SimNo < matched[j].SimNo
+	})
+	result := &simsResult{Total: len(matched), Sims: make([]msg.SimInfo, 0)}
+	if params.Offset < len(matched) {
+		matched = matched[params.Offset:]
+		if len(matched) > params.Limit {
+			matched = matched[:params.Limit]
+		}
+		for _, si := range matched {
+			si.FirstSeen, si.LastSeen = si.FirstSeen.In(loc), si.LastSeen.In(loc)
+			if si.LastLocation != nil {
+				si.LastLocation.Time = si.LastLocation.Time.In(loc)
+				si.LastLocation.Timestamp = si.LastLocation.Timestamp.In(loc)
+			}
+			result.Sims = append(result.Sims, si)
+		}
+	}
+	return result, http.StatusOK, nil
+}
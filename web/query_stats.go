@@ -0,0 +1,13 @@
+package web
+
+import (
+	"loghub/msg"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryStats returns the metrics of the DB write pipeline.
+func queryStats(mdb *msg.MsgDB, c *gin.Context) (res any, code int, err error) {
+	return mdb.WriteStats(), http.StatusOK, nil
+}